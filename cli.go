@@ -0,0 +1,263 @@
+package main
+
+import (
+	"WikiGo/crawler"
+	"WikiGo/db"
+	"WikiGo/logging"
+	"WikiGo/normalize"
+	"WikiGo/parser"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	// Registers the postgres driver used by --db
+	_ "github.com/lib/pq"
+)
+
+// Exit codes of the wikigo command
+const (
+	exitFound  = 0
+	exitNoPath = 1
+	exitError  = 2
+)
+
+const usage = `Usage: wikigo <command> [flags]
+
+Commands:
+  path    find the shortest chain of links between two articles
+
+Run "wikigo <command> -h" for the flags of a command.
+`
+
+// pathOutput : the JSON output of the path command
+type pathOutput struct {
+	From         string      `json:"from"`
+	To           string      `json:"to"`
+	Found        bool        `json:"found"`
+	Path         []string    `json:"path"`
+	Hops         []hopOutput `json:"hops"`
+	Depth        int         `json:"depth"`
+	PagesFetched int         `json:"pagesFetched"`
+	CacheHits    int         `json:"cacheHits"`
+	FailedPages  int         `json:"failedPages"`
+	SkippedPages int         `json:"skippedPages"`
+	ElapsedMS    int64       `json:"elapsedMs"`
+	Exhaustive   bool        `json:"exhaustive"`
+}
+
+// hopOutput : a page on the path in the JSON output of the path command
+type hopOutput struct {
+	Title      string `json:"title"`
+	URL        string `json:"url"`
+	AnchorText string `json:"anchorText,omitempty"`
+	Section    string `json:"section,omitempty"`
+}
+
+// run : Runs the command given by the arguments and returns the exit code
+func run(args []string, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprint(stderr, usage)
+		return exitError
+	}
+
+	switch args[0] {
+	case "path":
+		return runPath(args[1:], stdout, stderr)
+	case "help", "-h", "-help", "--help":
+		fmt.Fprint(stdout, usage)
+		return exitFound
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n%s", args[0], usage)
+		return exitError
+	}
+}
+
+// runPath : Finds the shortest path between the --from and --to articles
+func runPath(args []string, stdout io.Writer, stderr io.Writer) int {
+	flags := flag.NewFlagSet("path", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	from := flags.String("from", "", "title or URL of the article to start from")
+	to := flags.String("to", "", "title or URL of the article to find")
+	maxDepth := flags.Int("max-depth", crawler.DefaultMaxDepth, "maximum number of links to follow")
+	lang := flags.String("lang", "en", "language of the Wikipedia to search")
+	domain := flags.String("domain", "", "domain of the wiki to search, overriding --lang")
+	dbURL := flags.String("db", "", "postgres URL of the db to cache crawled pages in")
+	format := flags.String("format", "text", "output format, text or json")
+	timeout := flags.Duration("timeout", 0, "give up the search after this long, e.g. 30s")
+	verbose := flags.Bool("v", false, "log crawl progress to stderr")
+	contact := flags.String("contact", "", "email or URL added to the User-Agent so the wiki can reach you")
+	cacheDir := flags.String("cache-dir", "", "directory to keep downloaded pages in between runs")
+	cacheTTL := flags.Duration("cache-ttl", crawler.DefaultCachePolicy.TTL, "how long cached pages are used without revalidating")
+	rate := flags.Float64("rate", crawler.DefaultHostLimits.RequestsPerSecond, "max requests per second sent to the wiki")
+	linkFilter := flags.String("link-filter", "", "JSON file of rules deciding which links are followed")
+	links := flags.String("links", "all", "links of each article to follow: all, lead or first")
+	bidirectional := flags.Bool("bidirectional", false, "also search backwards from --to, listing backlinks with the MediaWiki API")
+
+	if err := flags.Parse(args); err != nil {
+		return exitError
+	}
+
+	if *from == "" || *to == "" {
+		fmt.Fprintln(stderr, "both --from and --to are required")
+		return exitError
+	}
+
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(stderr, "unknown format %q\n", *format)
+		return exitError
+	}
+
+	linkModes := map[string]parser.LinkMode{"all": parser.AllLinks, "lead": parser.LeadLinks, "first": parser.FirstLink}
+	linkMode, known := linkModes[*links]
+	if !known {
+		fmt.Fprintf(stderr, "unknown --links %q\n", *links)
+		return exitError
+	}
+
+	if *rate <= 0 {
+		fmt.Fprintln(stderr, "--rate must be positive")
+		return exitError
+	}
+
+	if *domain == "" {
+		*domain = "https://" + *lang + ".wikipedia.org"
+	}
+
+	var parserOpts []parser.Option
+	if *linkFilter != "" {
+		filter, err := parser.LoadLinkFilter(*linkFilter)
+		if err != nil {
+			fmt.Fprintf(stderr, "reading --link-filter: %v\n", err)
+			return exitError
+		}
+		parserOpts = append(parserOpts, parser.WithLinkFilter(filter))
+	}
+
+	level := logging.LevelWarn
+	if *verbose {
+		level = logging.LevelDebug
+	}
+	logger := logging.NewStdLogger(log.New(stderr, "", log.LstdFlags), level)
+
+	opts := []crawler.Option{
+		crawler.WithMaxDepth(*maxDepth),
+		crawler.WithTimeout(*timeout),
+		crawler.WithParser(crawler.NewWikipediaParser(*domain, parserOpts...)),
+		crawler.WithLinkMode(linkMode),
+		crawler.WithLogger(logger),
+		crawler.WithContact(*contact),
+	}
+
+	limits := crawler.DefaultHostLimits
+	limits.RequestsPerSecond = *rate
+	opts = append(opts, crawler.WithHostLimits(limits))
+
+	if *cacheDir != "" {
+		policy := crawler.DefaultCachePolicy
+		policy.TTL = *cacheTTL
+		opts = append(opts, crawler.WithHTTPCache(*cacheDir, policy))
+	}
+
+	if *dbURL != "" {
+		sqlDB, err := sql.Open("postgres", *dbURL)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitError
+		}
+		defer sqlDB.Close()
+
+		driver := db.NewSQLDriverWithLogger(sqlDB, logger)
+		if err := driver.Migrate(context.Background()); err != nil {
+			fmt.Fprintf(stderr, "preparing --db: %v\n", err)
+			return exitError
+		}
+
+		opts = append(opts, crawler.WithStore(db.NewDBServiceWithLogger(driver, logger)))
+	}
+
+	myCrawler, err := crawler.NewCrawler(articleURL(*domain, *from), articleURL(*domain, *to), opts...)
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	var result *crawler.SearchResult
+	if *bidirectional {
+		result, err = myCrawler.GetShortestPathBidirectional(context.Background(), nil)
+	} else {
+		result, err = myCrawler.GetShortestPathToArticle(context.Background())
+	}
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	if err := writePath(stdout, *format, *from, *to, result); err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitError
+	}
+
+	if !result.Found() {
+		return exitNoPath
+	}
+
+	return exitFound
+}
+
+// writePath : Writes the result of a search between two articles in the given format
+func writePath(w io.Writer, format string, from string, to string, result *crawler.SearchResult) error {
+	if format == "json" {
+		output := pathOutput{
+			From:         from,
+			To:           to,
+			Found:        result.Found(),
+			Path:         []string{},
+			Hops:         []hopOutput{},
+			Depth:        result.Depth,
+			PagesFetched: result.PagesFetched,
+			CacheHits:    result.CacheHits,
+			FailedPages:  result.FailedPages,
+			SkippedPages: result.SkippedPages,
+			ElapsedMS:    result.Elapsed.Nanoseconds() / int64(time.Millisecond),
+			Exhaustive:   result.Exhaustive,
+		}
+
+		for _, hop := range result.Hops {
+			output.Path = append(output.Path, hop.Title)
+			output.Hops = append(output.Hops, hopOutput{Title: hop.Title, URL: hop.URL, AnchorText: hop.AnchorText, Section: hop.Section})
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(output)
+	}
+
+	if !result.Found() {
+		_, err := fmt.Fprintf(w, "No path found from %s to %s within %d links\n", from, to, result.Depth)
+		return err
+	}
+
+	_, err := fmt.Fprintln(w, strings.Join(result.Titles(), " -> "))
+	return err
+}
+
+// articleURL : Gets the normalized URL of an article given either its URL or its title
+func articleURL(domain string, article string) string {
+	if strings.HasPrefix(article, "http://") || strings.HasPrefix(article, "https://") {
+		return normalize.URL(article)
+	}
+
+	if strings.HasPrefix(article, "/") {
+		return normalize.URL(domain + article)
+	}
+
+	title := strings.ReplaceAll(normalize.Title(article), " ", "_")
+	return normalize.URL(domain + normalize.ArticlePath + url.PathEscape(title))
+}
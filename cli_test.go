@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestWiki() *httptest.Server {
+	pages := map[string]string{
+		"/wiki/Fife":          `<html><head><title>Fife</title></head><body><h2>Mining</h2><a href="/wiki/Lawrence_Daly">Daly</a></body></html>`,
+		"/wiki/Lawrence_Daly": `<html><head><title>Lawrence Daly</title></head><body><a href="/wiki/Miners_strike">Strike</a></body></html>`,
+		"/wiki/Miners_strike": `<html><head><title>Miners strike</title></head><body></body></html>`,
+		"/wiki/Isolated_page": `<html><head><title>Isolated page</title></head><body></body></html>`,
+		"/wiki/Coal_board": `<html><head><title>Coal board</title></head><body><a href="/wiki/Fife">Fife</a>` +
+			`<a href="/wiki/Lawrence_Daly">Daly</a></body></html>`,
+	}
+
+	// The API knows of a link to the isolated page that the pages don't have, which only a search
+	// from both ends can follow
+	backlinks := map[string]string{
+		"Isolated page": `[{"ns":0,"title":"Lawrence Daly"}]`,
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/w/api.php" {
+			list := "[]"
+			if r.URL.Query().Get("blfilterredir") == "nonredirects" {
+				if links, exists := backlinks[r.URL.Query().Get("bltitle")]; exists {
+					list = links
+				}
+			}
+
+			fmt.Fprintf(w, `{"query":{"backlinks":%s}}`, list)
+			return
+		}
+
+		htm, exists := pages[r.URL.Path]
+		if !exists {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprint(w, htm)
+	}))
+}
+
+func TestArticleURL(t *testing.T) {
+	cases := map[string]string{
+		"Lawrence Daly":                      "https://en.wikipedia.org/wiki/Lawrence_Daly",
+		"UK miners' strike (1984–85)":        "https://en.wikipedia.org/wiki/UK_miners%27_strike_%281984%E2%80%9385%29",
+		"/wiki/Fife":                         "https://en.wikipedia.org/wiki/Fife",
+		"lawrence Daly":                      "https://en.wikipedia.org/wiki/Lawrence_Daly",
+		"/wiki/Fife#History":                 "https://en.wikipedia.org/wiki/Fife",
+		"https://de.wikipedia.org/wiki/Fife": "https://de.wikipedia.org/wiki/Fife",
+	}
+
+	for article, expected := range cases {
+		result := articleURL("https://en.wikipedia.org", article)
+		if result != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	server := newTestWiki()
+	defer server.Close()
+
+	t.Run("No command", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if code := run(nil, &stdout, &stderr); code != exitError {
+			t.Errorf("Expected exit code %d but got %d", exitError, code)
+		}
+	})
+
+	t.Run("Unknown command", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if code := run([]string{"walk"}, &stdout, &stderr); code != exitError {
+			t.Errorf("Expected exit code %d but got %d", exitError, code)
+		}
+	})
+
+	t.Run("Missing destination", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		if code := run([]string{"path", "--from", "Fife"}, &stdout, &stderr); code != exitError {
+			t.Errorf("Expected exit code %d but got %d", exitError, code)
+		}
+	})
+
+	t.Run("Rate must be positive", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"path", "--rate", "0", "--from", "Fife", "--to", "Miners strike"}, &stdout, &stderr)
+
+		if code != exitError {
+			t.Errorf("Expected exit code %d but got %d", exitError, code)
+		}
+	})
+
+	t.Run("Unreadable link filter", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"path", "--link-filter", "missing.json", "--from", "Fife", "--to", "Miners strike"}, &stdout, &stderr)
+
+		if code != exitError {
+			t.Errorf("Expected exit code %d but got %d", exitError, code)
+		}
+	})
+
+	t.Run("Unknown link mode", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"path", "--links", "random", "--from", "Fife", "--to", "Miners strike"}, &stdout, &stderr)
+
+		if code != exitError {
+			t.Errorf("Expected exit code %d but got %d", exitError, code)
+		}
+	})
+
+	t.Run("Print the path as text", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"path", "--domain", server.URL, "--from", "Fife", "--to", "Miners strike"}, &stdout, &stderr)
+
+		if code != exitFound {
+			t.Errorf("Expected exit code %d but got %d: %s", exitFound, code, stderr.String())
+		}
+
+		expected := "Fife -> Lawrence Daly -> Miners strike\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, stdout.String())
+		}
+	})
+
+	t.Run("Print the path as JSON", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"path", "--domain", server.URL, "--format", "json",
+			"--from", "Fife", "--to", server.URL + "/wiki/Lawrence_Daly"}, &stdout, &stderr)
+
+		if code != exitFound {
+			t.Errorf("Expected exit code %d but got %d: %s", exitFound, code, stderr.String())
+		}
+
+		var output pathOutput
+		if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+			t.Fatal(err)
+		}
+
+		if !output.Found || strings.Join(output.Path, "|") != "Fife|Lawrence Daly" {
+			t.Errorf("Expected the path from Fife to Lawrence Daly but got %+v", output)
+		}
+
+		if output.Hops[1].AnchorText != "Daly" || output.Hops[1].Section != "Mining" ||
+			output.Hops[1].URL != server.URL+"/wiki/Lawrence_Daly" {
+			t.Errorf("Expected the hop to Lawrence Daly through its link but got %+v", output.Hops[1])
+		}
+
+		if output.Depth != 1 || output.PagesFetched != 1 || !output.Exhaustive {
+			t.Errorf("Expected 1 link and 1 page fetched but got %+v", output)
+		}
+	})
+
+	t.Run("Search from both ends", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"path", "--domain", server.URL, "--bidirectional", "--max-depth", "2",
+			"--from", "Coal board", "--to", "Isolated page"}, &stdout, &stderr)
+
+		if code != exitFound {
+			t.Errorf("Expected exit code %d but got %d: %s", exitFound, code, stderr.String())
+		}
+
+		expected := "Coal board -> Lawrence Daly -> Isolated page\n"
+		if stdout.String() != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, stdout.String())
+		}
+	})
+
+	t.Run("No path within depth", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"path", "--domain", server.URL, "--max-depth", "1",
+			"--from", "Fife", "--to", "Miners strike"}, &stdout, &stderr)
+
+		if code != exitNoPath {
+			t.Errorf("Expected exit code %d but got %d: %s", exitNoPath, code, stderr.String())
+		}
+	})
+
+	t.Run("Unknown article is an error", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		code := run([]string{"path", "--domain", server.URL, "--from", "Fife", "--to", "Nowhere"}, &stdout, &stderr)
+
+		if code != exitError {
+			t.Errorf("Expected exit code %d but got %d", exitError, code)
+		}
+	})
+}
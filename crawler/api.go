@@ -0,0 +1,132 @@
+package crawler
+
+import (
+	"WikiGo/fetcher"
+	"WikiGo/normalize"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	neturl "net/url"
+	"strings"
+)
+
+// MediaWikiAPI : Lists the pages linking or redirecting to an article with the MediaWiki action API
+type MediaWikiAPI struct {
+	domain      string
+	pageFetcher fetcher.Fetcher
+	maxRequests int
+}
+
+// NewMediaWikiAPI : Creates an API source whose api.php is at /w/ on the wiki of each article, or
+// on the given domain for relative article URLs
+func NewMediaWikiAPI(domain string, pageFetcher fetcher.Fetcher) *MediaWikiAPI {
+	return &MediaWikiAPI{domain: domain, pageFetcher: pageFetcher}
+}
+
+// NewMediaWikiAPIWithMaxRequests : Creates an API source that truncates lists after maxRequests requests
+func NewMediaWikiAPIWithMaxRequests(domain string, pageFetcher fetcher.Fetcher, maxRequests int) *MediaWikiAPI {
+	api := NewMediaWikiAPI(domain, pageFetcher)
+	api.maxRequests = maxRequests
+	return api
+}
+
+// apiBacklinksResponse : the parts of a list=backlinks response of the API that are used
+type apiBacklinksResponse struct {
+	Continue map[string]string `json:"continue"`
+	Query    struct {
+		Backlinks []struct {
+			Title string `json:"title"`
+		} `json:"backlinks"`
+	} `json:"query"`
+	Error *struct {
+		Code string `json:"code"`
+		Info string `json:"info"`
+	} `json:"error"`
+}
+
+// Backlinks : Gets the URLs of the articles that link to the article at the given URL
+func (a *MediaWikiAPI) Backlinks(ctx context.Context, url string) ([]string, error) {
+	return a.backlinks(ctx, url, "nonredirects")
+}
+
+// Redirects : Gets the URLs of the articles that redirect to the article at the given URL
+func (a *MediaWikiAPI) Redirects(ctx context.Context, url string) ([]string, error) {
+	return a.backlinks(ctx, url, "redirects")
+}
+
+// backlinks : Gets the URLs of the articles linking to the given one, filtered as blfilterredir is
+func (a *MediaWikiAPI) backlinks(ctx context.Context, url string, filter string) ([]string, error) {
+	pageName := normalize.PageName(url)
+	if pageName == "" {
+		return nil, errors.New("Not an article URL: " + url)
+	}
+
+	query := neturl.Values{}
+	query.Set("action", "query")
+	query.Set("list", "backlinks")
+	query.Set("bltitle", normalize.Title(pageName))
+	query.Set("blnamespace", "0")
+	query.Set("blfilterredir", filter)
+	query.Set("bllimit", "max")
+	query.Set("format", "json")
+	query.Set("formatversion", "2")
+
+	wiki := a.wikiOf(url)
+	backlinks := make([]string, 0)
+	requested := make(map[string]bool)
+	for {
+		request := wiki + "/w/api.php?" + query.Encode()
+		if requested[request] {
+			return backlinks, nil
+		}
+
+		if a.maxRequests > 0 && len(requested) >= a.maxRequests {
+			return backlinks, fmt.Errorf("%w: %s: stopped after %d requests", ErrBacklinksTruncated, url, a.maxRequests)
+		}
+		requested[request] = true
+
+		body, _, err := a.pageFetcher.Fetch(ctx, request)
+		if err != nil {
+			return nil, err
+		}
+
+		var response apiBacklinksResponse
+		if err := json.Unmarshal(body, &response); err != nil {
+			return nil, err
+		}
+
+		if response.Error != nil {
+			return nil, fmt.Errorf("MediaWiki API error %s: %s", response.Error.Code, response.Error.Info)
+		}
+
+		for _, backlink := range response.Query.Backlinks {
+			backlinks = append(backlinks, articleURL(wiki, backlink.Title))
+		}
+
+		if len(response.Continue) == 0 {
+			return backlinks, nil
+		}
+
+		for key, value := range response.Continue {
+			query.Set(key, value)
+		}
+	}
+}
+
+// wikiOf : Gets the scheme and host of the wiki of the article at the given URL, or the API's
+// domain if the URL is relative
+func (a *MediaWikiAPI) wikiOf(url string) string {
+	parsed, err := neturl.Parse(url)
+	if err != nil || parsed.Host == "" {
+		return a.domain
+	}
+
+	return parsed.Scheme + "://" + parsed.Host
+}
+
+// articleURL : Gets the URL of the article with the given title on the wiki at the given domain
+func articleURL(domain string, title string) string {
+	path := &neturl.URL{Path: normalize.ArticlePath + strings.ReplaceAll(title, " ", "_")}
+	return domain + path.EscapedPath()
+}
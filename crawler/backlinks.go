@@ -0,0 +1,225 @@
+package crawler
+
+import (
+	"WikiGo/db"
+	"WikiGo/fetcher"
+	"WikiGo/parser"
+	"WikiGo/wikipage"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"golang.org/x/net/html"
+	neturl "net/url"
+	"strings"
+)
+
+// WhatLinksHereListID : id of the list of linking pages on a MediaWiki Special:WhatLinksHere page
+const WhatLinksHereListID = "mw-whatlinkshere-list"
+
+// whatLinksHereNextClass : class of the "next 500" link to the following page of a WhatLinksHere list
+const whatLinksHereNextClass = "mw-nextlink"
+
+// ErrBacklinksTruncated : matches the error returned with the backlinks listed so far when a
+// source stops before the end of the list, so the backlinks aren't all the pages linking there
+var ErrBacklinksTruncated = errors.New("backlink list truncated")
+
+// BacklinkSource : interface for listing the pages that link to a given page, used to
+// expand the search backwards from the destination. A source that lists only part of the
+// backlinks returns them with an error matching ErrBacklinksTruncated
+type BacklinkSource interface {
+	Backlinks(ctx context.Context, url string) ([]string, error)
+}
+
+// DBBacklinkSource : Backlink source that reads the edges of pages already cached in the db
+type DBBacklinkSource struct {
+	dbService *db.Service
+}
+
+// NewDBBacklinkSource : Creates a backlink source backed by the given db service
+func NewDBBacklinkSource(dbService *db.Service) *DBBacklinkSource {
+	return &DBBacklinkSource{dbService: dbService}
+}
+
+// Backlinks : Gets the URLs of the cached pages that link to the given URL
+func (s *DBBacklinkSource) Backlinks(ctx context.Context, url string) ([]string, error) {
+	return s.dbService.GetBacklinks(ctx, wikipage.KeyFromURL(url)), nil
+}
+
+// WhatLinksHereSource : Backlink source that parses the Special:WhatLinksHere page of a MediaWiki
+// site. Wikipedia's robots.txt disallows special pages, so use MediaWikiAPI there instead
+type WhatLinksHereSource struct {
+	domain      string
+	wikiParser  *parser.Parser
+	pageFetcher fetcher.Fetcher
+	maxPages    int
+}
+
+// NewWhatLinksHereSource : Creates a backlink source for the wiki at the given domain. Links on the
+// WhatLinksHere pages are filtered with the given parser, so it should be configured like the crawler's
+func NewWhatLinksHereSource(domain string, wikiParser *parser.Parser, pageFetcher fetcher.Fetcher) *WhatLinksHereSource {
+	return &WhatLinksHereSource{domain: domain, wikiParser: wikiParser, pageFetcher: pageFetcher}
+}
+
+// NewWhatLinksHereSourceWithMaxPages : Creates a backlink source like NewWhatLinksHereSource that
+// fetches at most maxPages pages of 500 backlinks for each article, if it is positive. Longer
+// lists are cut short, and returned with an error matching ErrBacklinksTruncated
+func NewWhatLinksHereSourceWithMaxPages(domain string, wikiParser *parser.Parser, pageFetcher fetcher.Fetcher,
+	maxPages int) *WhatLinksHereSource {
+
+	source := NewWhatLinksHereSource(domain, wikiParser, pageFetcher)
+	source.maxPages = maxPages
+	return source
+}
+
+// Backlinks : Gets the URLs of the articles that link to the article at the given URL, following
+// the "next 500" links of the WhatLinksHere list to the end of it or the source's page limit
+func (s *WhatLinksHereSource) Backlinks(ctx context.Context, url string) ([]string, error) {
+	pageName := articleName(url)
+	if pageName == "" {
+		return nil, errors.New("Not an article URL: " + url)
+	}
+
+	backlinks := make([]string, 0)
+	fetched := make(map[string]bool)
+	next := s.domain + "/wiki/Special:WhatLinksHere/" + pageName + "?limit=500"
+
+	for next != "" && !fetched[next] {
+		if s.maxPages > 0 && len(fetched) >= s.maxPages {
+			return backlinks, fmt.Errorf("%w: %s: stopped after %d pages", ErrBacklinksTruncated, url, s.maxPages)
+		}
+		fetched[next] = true
+
+		body, finalURL, err := s.pageFetcher.Fetch(ctx, next)
+		if err != nil {
+			return nil, err
+		}
+
+		links, err := s.wikiParser.GetLinksInElement(string(body), WhatLinksHereListID)
+		if err != nil {
+			return nil, err
+		}
+		backlinks = append(backlinks, links...)
+
+		next = whatLinksHereNextPage(body, finalURL)
+	}
+
+	return backlinks, nil
+}
+
+// whatLinksHereNextPage : Gets the absolute URL of the following page of a WhatLinksHere list
+// from its "next 500" link, or nothing on the last page. The link has the mw-nextlink class on
+// recent MediaWiki versions, and older ones are recognised by its text and from= query
+func whatLinksHereNextPage(body []byte, pageURL string) string {
+	tokenizer := html.NewTokenizer(bytes.NewReader(body))
+	href, candidate := "", false
+
+	for {
+		switch tokenizer.Next() {
+		case html.ErrorToken:
+			return ""
+		case html.StartTagToken:
+			token := tokenizer.Token()
+			if token.Data != "a" {
+				continue
+			}
+
+			href, candidate = "", false
+			class := ""
+			for _, attr := range token.Attr {
+				switch attr.Key {
+				case "href":
+					href = attr.Val
+				case "class":
+					class = attr.Val
+				}
+			}
+
+			if containsField(class, whatLinksHereNextClass) {
+				return resolveReference(pageURL, href)
+			}
+			candidate = strings.Contains(href, "from=")
+		case html.TextToken:
+			if candidate && strings.HasPrefix(strings.TrimSpace(string(tokenizer.Text())), "next") {
+				return resolveReference(pageURL, href)
+			}
+		case html.EndTagToken:
+			candidate = false
+		}
+	}
+}
+
+// resolveReference : Resolves an href against the URL of the page it is on, or gets nothing if
+// either can't be parsed
+func resolveReference(pageURL string, href string) string {
+	base, err := neturl.Parse(pageURL)
+	if err != nil || href == "" {
+		return ""
+	}
+
+	reference, err := neturl.Parse(href)
+	if err != nil {
+		return ""
+	}
+
+	return base.ResolveReference(reference).String()
+}
+
+func containsField(text string, field string) bool {
+	for _, candidate := range strings.Fields(text) {
+		if candidate == field {
+			return true
+		}
+	}
+
+	return false
+}
+
+// chainedBacklinkSource : Backlink source that asks each source in turn until one has results
+type chainedBacklinkSource struct {
+	sources []BacklinkSource
+}
+
+// ChainBacklinkSources : Combines backlink sources so that later sources are only asked when the
+// earlier ones know of no backlinks, e.g. the db cache first and WhatLinksHere second
+func ChainBacklinkSources(sources ...BacklinkSource) BacklinkSource {
+	return &chainedBacklinkSource{sources: sources}
+}
+
+// Backlinks : Gets the backlinks from the first source that has any, with the error of a source
+// whose list was truncated
+func (s *chainedBacklinkSource) Backlinks(ctx context.Context, url string) ([]string, error) {
+	var lastErr error
+	for _, source := range s.sources {
+		links, err := source.Backlinks(ctx, url)
+		if errors.Is(err, ErrBacklinksTruncated) && len(links) != 0 {
+			return links, err
+		}
+
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		if len(links) != 0 {
+			return links, nil
+		}
+	}
+
+	return nil, lastErr
+}
+
+// articleName : Gets the article name following /wiki/ in a URL, without any query or fragment
+func articleName(url string) string {
+	index := strings.Index(url, "/wiki/")
+	if index == -1 {
+		return ""
+	}
+
+	name := url[index+len("/wiki/"):]
+	if end := strings.IndexAny(name, "?#"); end != -1 {
+		name = name[:end]
+	}
+
+	return name
+}
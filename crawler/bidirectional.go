@@ -0,0 +1,287 @@
+package crawler
+
+import (
+	"WikiGo/parser"
+	"WikiGo/wikipage"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// bidirectionalSearch : the state of a search expanding from both ends, meeting on page keys
+type bidirectionalSearch struct {
+	searchStats
+	forward    *visitedSet
+	backward   *visitedSet
+	parents    map[string]string
+	children   map[string]string
+	titles     map[string]string
+	canonicals map[string]string
+	anchors    map[edge]parser.Link
+	budget     *errorBudget
+}
+
+// GetShortestPathBidirectional : Searches from both ends, with the crawler's backlink source if nil
+func (c *Crawler) GetShortestPathBidirectional(ctx context.Context, backlinks BacklinkSource) (*SearchResult, error) {
+	if backlinks == nil {
+		backlinks = c.backlinks
+	}
+
+	started := time.Now()
+	ctx, cancel := c.searchContext(ctx)
+	defer cancel()
+
+	if err := c.Resolve(ctx); err != nil {
+		return nil, err
+	}
+
+	search := bidirectionalSearch{
+		forward:    newVisitedSet(),
+		backward:   newVisitedSet(),
+		parents:    make(map[string]string),
+		children:   make(map[string]string),
+		titles:     map[string]string{c.src: c.srcTitle, c.dest: c.destTitle},
+		canonicals: map[string]string{c.src: c.src, c.dest: c.dest},
+		anchors:    make(map[edge]parser.Link),
+		budget:     &errorBudget{limit: c.errorBudget, cancel: cancel},
+	}
+	search.forward.addURL(c.src, 0)
+	search.forward.add(c.srcKey, c.src, 0)
+	search.backward.addURL(c.dest, 0)
+	for key := range c.destKeys {
+		search.backward.add(key, c.dest, 0)
+	}
+
+	path, err := c.searchBidirectional(ctx, &search, backlinks)
+	if err != nil {
+		c.logger.Warn("search stopped", "src", c.src, "dest", c.dest, "err", err)
+		return nil, err
+	}
+
+	result := newSearchResult(path, search.titles, search.canonicals, search.anchors, c.limit, search.searchStats, started)
+	c.logResult(result)
+	return result, nil
+}
+
+// searchBidirectional : Alternates between a forward BFS level from src and a backward BFS level
+// from dest, always expanding the smaller frontier. Each level adds one hop, so the first level
+// on which the searches meet holds the shortest paths
+func (c *Crawler) searchBidirectional(ctx context.Context, search *bidirectionalSearch,
+	backlinks BacklinkSource) ([]string, error) {
+
+	if c.src == c.dest || c.destKeys[c.srcKey] {
+		return []string{c.src}, nil
+	}
+
+	forwardFrontier := []string{c.src}
+	backwardFrontier := []string{c.dest}
+
+	for hops := 0; hops < c.limit && len(forwardFrontier) > 0 && len(backwardFrontier) > 0; hops++ {
+		var meetings []wikipage.PageKey
+		c.logger.Debug("expanding level", "hops", hops, "forward", len(forwardFrontier), "backward", len(backwardFrontier))
+		if len(forwardFrontier) <= len(backwardFrontier) {
+			forwardFrontier, meetings = c.expandForward(ctx, search, forwardFrontier)
+		} else {
+			backwardFrontier, meetings = c.expandBackward(ctx, search, backwardFrontier, backlinks)
+		}
+
+		if err := search.budget.stopErr(ctx); err != nil {
+			return nil, &PartialResultError{Depth: hops, PagesVisited: search.pagesFetched + search.cacheHits, Err: err}
+		}
+
+		if len(meetings) == 0 {
+			continue
+		}
+
+		best := meetings[0]
+		for _, meeting := range meetings[1:] {
+			if search.length(meeting) < search.length(best) {
+				best = meeting
+			}
+		}
+
+		return c.joinPaths(ctx, search, best)
+	}
+
+	return nil, nil
+}
+
+// length : Gets the length of the path through the page with the given key
+func (s *bidirectionalSearch) length(key wikipage.PageKey) int {
+	forward, _ := s.forward.get(key)
+	backward, _ := s.backward.get(key)
+	return forward.depth + backward.depth
+}
+
+// expandForward : Fetches a forward frontier and returns the next one, with the keys of the pages
+// on which the forward search met the backward search
+func (c *Crawler) expandForward(ctx context.Context, search *bidirectionalSearch,
+	frontier []string) ([]string, []wikipage.PageKey) {
+
+	next := make([]string, 0)
+	meetings := make([]wikipage.PageKey, 0)
+
+	for _, page := range c.expandFrontier(ctx, frontier, search.budget) {
+		search.record(page)
+		if page.err != nil {
+			continue
+		}
+
+		search.titles[page.url], search.canonicals[page.url] = page.title, page.canonical
+		reached, _ := search.forward.get(wikipage.KeyFromURL(page.url))
+		if page.key != wikipage.KeyFromURL(page.url) {
+			if _, first := search.forward.add(page.key, page.url, reached.depth); !first {
+				continue
+			}
+			if _, met := search.backward.get(page.key); met {
+				meetings = append(meetings, page.key)
+				continue
+			}
+		}
+
+		for _, link := range page.links {
+			key := wikipage.KeyFromURL(link.URL)
+			if _, first := search.forward.add(key, link.URL, reached.depth+1); !first {
+				continue
+			}
+
+			search.parents[link.URL] = page.url
+			search.anchors[edge{from: page.url, to: link.URL}] = link
+			if _, met := search.backward.get(key); met {
+				meetings = append(meetings, key)
+			}
+
+			next = append(next, link.URL)
+		}
+	}
+
+	return next, meetings
+}
+
+// expandBackward : Lists the backlinks of a backward frontier and returns the next one, with the
+// nodes on which the backward search met the forward search
+func (c *Crawler) expandBackward(ctx context.Context, search *bidirectionalSearch, frontier []string,
+	backlinks BacklinkSource) ([]string, []wikipage.PageKey) {
+
+	results := make([][]string, len(frontier))
+	errs := make([]error, len(frontier))
+	maxChan := make(chan bool, c.concurrency)
+	var wg sync.WaitGroup
+
+	for index, url := range frontier {
+		wg.Add(1)
+		maxChan <- true
+		go func(index int, url string) {
+			defer wg.Done()
+			defer func() { <-maxChan }()
+
+			if err := ctx.Err(); err != nil {
+				errs[index] = err
+				return
+			}
+
+			results[index], errs[index] = backlinks.Backlinks(ctx, url)
+			if errors.Is(errs[index], ErrBacklinksTruncated) {
+				c.logger.Warn("backlink list truncated", "url", url, "backlinks", len(results[index]))
+				return
+			}
+
+			search.budget.spend(ctx, errs[index])
+			if errs[index] != nil {
+				c.logger.Warn("listing backlinks failed", "url", url, "err", errs[index])
+			}
+		}(index, url)
+	}
+
+	wg.Wait()
+
+	next := make([]string, 0)
+	meetings := make([]wikipage.PageKey, 0)
+
+	for index, url := range frontier {
+		if errors.Is(errs[index], ErrBacklinksTruncated) {
+			search.truncatedLists++
+		} else if errs[index] != nil {
+			search.failedPages++
+			continue
+		}
+
+		reached, _ := search.backward.get(wikipage.KeyFromURL(url))
+		for _, link := range results[index] {
+			key := wikipage.KeyFromURL(link)
+			if _, first := search.backward.add(key, link, reached.depth+1); !first {
+				continue
+			}
+
+			search.children[link] = url
+			if _, met := search.forward.get(key); met {
+				meetings = append(meetings, key)
+			}
+
+			next = append(next, link)
+		}
+	}
+
+	return next, meetings
+}
+
+// joinPaths : Builds the path through the page the searches met on from the forward and backward
+// pointers, fetching the titles of any nodes that have only been seen as links. Backlinks carry
+// no link context, so the pages from the meeting node on are parsed for the links the path
+// follows, leaving the anchor empty if one of them can't be fetched
+func (c *Crawler) joinPaths(ctx context.Context, search *bidirectionalSearch, meeting wikipage.PageKey) ([]string, error) {
+	forward, _ := search.forward.get(meeting)
+	backward, _ := search.backward.get(meeting)
+
+	path := make([]string, 0)
+	for node := forward.url; node != ""; node = search.parents[node] {
+		path = append([]string{node}, path...)
+	}
+
+	for node := search.children[backward.url]; node != ""; node = search.children[node] {
+		path = append(path, node)
+	}
+
+	for index, url := range path {
+		_, known := search.titles[url]
+		anchored := index == len(path)-1 || search.hasAnchor(url, path[index+1])
+		if known && anchored {
+			continue
+		}
+
+		page := c.fetchPage(ctx, url)
+		search.record(page)
+		if page.err != nil && known {
+			c.logger.Warn("fetching link context failed", "url", url, "err", page.err)
+			continue
+		} else if page.err != nil {
+			return nil, page.err
+		}
+
+		search.titles[url], search.canonicals[url] = page.title, page.canonical
+		if !anchored {
+			search.anchorTo(url, page, path[index+1])
+		}
+	}
+
+	return path, nil
+}
+
+// hasAnchor : Reports whether the link from one node to the other is known
+func (s *bidirectionalSearch) hasAnchor(from string, to string) bool {
+	_, exists := s.anchors[edge{from: from, to: to}]
+	return exists
+}
+
+// anchorTo : Records the link of the page at the given URL to the next node on the path, matched
+// by key when the page links to another URL of the same article
+func (s *bidirectionalSearch) anchorTo(url string, page crawledPage, to string) {
+	key := wikipage.KeyFromURL(to)
+	for _, link := range page.links {
+		if link.URL == to || wikipage.KeyFromURL(link.URL) == key {
+			s.anchors[edge{from: url, to: to}] = link
+			return
+		}
+	}
+}
@@ -2,223 +2,492 @@ package crawler
 
 import (
 	"WikiGo/db"
+	"WikiGo/fetcher"
+	"WikiGo/logging"
+	"WikiGo/normalize"
 	"WikiGo/parser"
 	"WikiGo/wikipage"
+	"context"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
 	"sync"
 	"time"
 )
 
-// FileLimit : max number of files that can be open at once
+// FileLimit : max number of pages that can be fetched at once, whatever the configured concurrency
 const (
 	FileLimit = 1000
 )
 
-// Crawler : struct that has a source and destination page with a map cache of shortest distances
-//          between the page (key) and destination
+// Crawler : struct that has a source and destination page and searches for the shortest
+// chain of links between them, caching crawled pages in the db service
 type Crawler struct {
-	wikiParser   *parser.Parser
-	src          string
-	dest         string
-	srcTitle     string
-	destTitle    string
-	limit        int
-	isWebCrawler bool
-	shortestPath []string
-	netClient    http.Client
-	mux          sync.Mutex
-	dbService    *db.Service
-	urlMap       map[string]string
-}
-
-// NewCrawler : creates a new Crawler object with src and dest pages
-func NewCrawler(src string, dest string, domain string, pattern []string, exclude []string, trimMarker []string,
-	limit int, isWebCrawler bool, dbService *db.Service) *Crawler {
-
-	c := Crawler{src: src, dest: dest, limit: limit, isWebCrawler: isWebCrawler, dbService: dbService}
-	c.urlMap = c.dbService.GetURLs()
-	c.wikiParser = parser.NewParser(domain, pattern, exclude, trimMarker)
-	c.shortestPath = make([]string, 0)
-	srcHTML, _ := c.getHTMLFromURL(src)
-	destHTML, _ := c.getHTMLFromURL(dest)
-	c.srcTitle, _ = c.wikiParser.ExtractDocumentTitle(srcHTML)
-	c.destTitle, _ = c.wikiParser.ExtractDocumentTitle(destHTML)
-	tr := &http.Transport{
-		MaxIdleConns:        15,
-		MaxIdleConnsPerHost: 15,
-		IdleConnTimeout:     30 * time.Second,
-		DisableCompression:  true,
-	}
-	c.netClient = http.Client{Transport: tr}
-	return &c
+	wikiParser  *parser.Parser
+	src         string
+	dest        string
+	srcKey      wikipage.PageKey
+	destKey     wikipage.PageKey
+	srcTitle    string
+	destTitle   string
+	limit       int
+	concurrency int
+	timeout     time.Duration
+	errorBudget int
+	pageFetcher fetcher.Fetcher
+	dbService   *db.Service
+	redirects   RedirectSource
+	backlinks   BacklinkSource
+	logger      logging.Logger
+	crawledKeys map[wikipage.PageKey]bool
+	destKeys    map[wikipage.PageKey]bool
+	resolved    map[string]crawledPage
 }
 
-// GetShortestPathToArticle : Takes two URLs and computes the shortest way to
-//                           get from one to the other through links
-func (c *Crawler) GetShortestPathToArticle() ([]string, error) {
-	if c.srcTitle == "" || c.destTitle == "" {
-		return nil, errors.New("Unable to retrieve src or destination page")
+// ErrSourceNotFound : matches the error returned when the source page can't be retrieved
+var ErrSourceNotFound = errors.New("source page not found")
+
+// ErrDestinationNotFound : matches the error returned when the destination page can't be retrieved
+var ErrDestinationNotFound = errors.New("destination page not found")
+
+// ResolveError : Returned when the source or destination page can't be resolved. It matches
+// ErrSourceNotFound or ErrDestinationNotFound with errors.Is and unwraps to the underlying error
+type ResolveError struct {
+	Endpoint error
+	URL      string
+	Err      error
+}
+
+func (e *ResolveError) Error() string {
+	return fmt.Sprintf("%v: %s: %v", e.Endpoint, e.URL, e.Err)
+}
+
+// Is : Reports whether the target is the endpoint that could not be resolved
+func (e *ResolveError) Is(target error) bool {
+	return target == e.Endpoint
+}
+
+// Unwrap : Gets the error that stopped the page being resolved
+func (e *ResolveError) Unwrap() error {
+	return e.Err
+}
+
+// NewCrawler : creates a new Crawler object with src and dest pages, configured by the given options
+// on top of defaults for English Wikipedia. No pages are fetched until the crawler is resolved
+func NewCrawler(src string, dest string, opts ...Option) (*Crawler, error) {
+	if src == "" || dest == "" {
+		return nil, errors.New("src and dest pages are required")
 	}
 
-	for i := 1; i <= c.limit; i++ {
-		if c.shortestPath != nil && len(c.shortestPath) != 0 {
-			fmt.Println("SUCCESS")
-			printPath(c.shortestPath)
-			return c.shortestPath, nil
-		}
+	conf := defaultConfig()
+	for _, opt := range opts {
+		opt(&conf)
+	}
 
-		fmt.Println(i)
-		history := make([]string, 0)
-		maxChan := make(chan bool, FileLimit)
-		var wg sync.WaitGroup
+	if err := conf.validate(); err != nil {
+		return nil, err
+	}
 
-		wg.Add(1)
-		maxChan <- true
-		c.crawl(c.src, history, i, &wg, maxChan)
+	var apiFetcher fetcher.Fetcher
+	if conf.pageFetcher == nil {
+		var err error
+		if conf.pageFetcher, apiFetcher, err = conf.newHTTPFetchers(); err != nil {
+			return nil, err
+		}
+	}
 
-		wg.Wait()
+	if conf.wikiParser == nil {
+		conf.wikiParser = NewWikipediaParser(DefaultDomain)
 	}
 
-	if c.shortestPath != nil && len(c.shortestPath) != 0 {
-		fmt.Println("SUCCESS")
-		printPath(c.shortestPath)
-		return c.shortestPath, nil
+	if conf.linkMode != parser.AllLinks {
+		conf.wikiParser = conf.wikiParser.With(parser.WithLinkMode(conf.linkMode))
 	}
 
-	fmt.Println("FAIL")
-	return nil, nil
+	redirects, backlinks := conf.sources(conf.wikiParser.Domain(), apiFetcher)
+	c := Crawler{
+		wikiParser:  conf.wikiParser,
+		src:         src,
+		dest:        dest,
+		limit:       conf.maxDepth,
+		concurrency: conf.concurrency,
+		timeout:     conf.timeout,
+		errorBudget: conf.errorBudget,
+		pageFetcher: conf.pageFetcher,
+		dbService:   conf.dbService,
+		redirects:   redirects,
+		backlinks:   backlinks,
+		logger:      conf.logger,
+		crawledKeys: make(map[wikipage.PageKey]bool),
+	}
+	return &c, nil
 }
 
-func (c *Crawler) crawl(url string, history []string, maxDepth int, wg *sync.WaitGroup, maxChan chan bool) {
-	defer wg.Done()
-	defer func(maxChan chan bool) { <-maxChan }(maxChan)
+// Resolve : Fetches src and dest once, following redirects, and loads the keys searches match pages by
+func (c *Crawler) Resolve(ctx context.Context) error {
+	if c.resolved != nil {
+		return nil
+	}
 
-	var title string
-	var links []string
+	if c.dbService != nil {
+		for key := range c.dbService.GetURLs(ctx) {
+			c.crawledKeys[key] = true
+		}
+	}
 
-	if c.urlMap != nil {
-		title = c.urlMap[url]
+	src := c.fetchPage(ctx, c.src)
+	if src.err != nil {
+		return &ResolveError{Endpoint: ErrSourceNotFound, URL: c.src, Err: src.err}
 	}
 
-	if title == "" {
-		htm, err := c.getHTMLFromURL(url)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
+	dest := c.fetchPage(ctx, c.dest)
+	if dest.err != nil {
+		return &ResolveError{Endpoint: ErrDestinationNotFound, URL: c.dest, Err: dest.err}
+	}
 
-		title, err = c.wikiParser.ExtractDocumentTitle(htm)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
+	c.destKeys = map[wikipage.PageKey]bool{dest.key: true, wikipage.KeyFromURL(c.dest): true}
+	src.url, dest.url = src.canonical, dest.canonical
+	c.src, c.srcKey, c.srcTitle = src.canonical, src.key, src.title
+	c.dest, c.destKey, c.destTitle = dest.canonical, dest.key, dest.title
+	c.resolved = map[string]crawledPage{c.src: src, c.dest: dest}
 
-		if title == "" {
-			fmt.Println("Error retrieving document")
-			return
-		}
+	redirects, err := c.redirects.Redirects(ctx, c.dest)
+	if err != nil {
+		c.logger.Warn("listing redirects failed", "dest", c.dest, "err", err)
+	}
+	for _, redirect := range redirects {
+		c.destKeys[wikipage.KeyFromURL(redirect)] = true
 	}
+	c.logger.Debug("resolved endpoints", "src", c.src, "srcKey", c.srcKey, "dest", c.dest, "destKey", c.destKey)
+	return nil
+}
+
+// PartialResultError : Returned when a search stops early, with the number of levels fully explored
+type PartialResultError struct {
+	Depth        int
+	PagesVisited int
+	Err          error
+}
+
+func (e *PartialResultError) Error() string {
+	return fmt.Sprintf("search stopped after exploring %d levels and %d pages: %v", e.Depth, e.PagesVisited, e.Err)
+}
+
+// Unwrap : Gets the error that stopped the search
+func (e *PartialResultError) Unwrap() error {
+	return e.Err
+}
 
-	page := c.dbService.GetPage(title)
-	path := append(history, title)
-	fmt.Println(title)
+// ErrErrorBudgetExceeded : matches the error returned when a search failed to fetch more pages
+// than its error budget allows
+var ErrErrorBudgetExceeded = errors.New("error budget exceeded")
+
+// errorBudget : counts the pages a search failed to fetch, cancelling the search once the
+// budget is spent. A zero limit never runs out
+type errorBudget struct {
+	limit  int
+	mux    sync.Mutex
+	failed int
+	cancel context.CancelFunc
+}
 
-	if title == c.destTitle {
-		c.updateShortestPath(path)
+// spend : Counts a failed page against the budget, unless it was skipped or its search was stopped
+func (b *errorBudget) spend(ctx context.Context, err error) {
+	if err == nil || b.limit == 0 || errors.Is(err, fetcher.ErrDisallowedByRobots) || ctx.Err() != nil {
 		return
 	}
 
-	if len(path) > maxDepth {
-		return
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	b.failed++
+	if b.failed >= b.limit {
+		b.cancel()
 	}
+}
 
-	if page != nil {
-		if page.GetCrawledStatus() {
-			links = page.GetLinks()
-		} else {
-			return
-		}
-	} else {
-		htm, err := c.getHTMLFromURL(url)
-		if err != nil {
-			fmt.Println(err)
-			return
-		}
+// stopErr : Gets the error that stopped the search with the given context, if it was stopped
+func (b *errorBudget) stopErr(ctx context.Context) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+
+	if b.limit != 0 && b.failed >= b.limit {
+		return ErrErrorBudgetExceeded
+	}
+
+	return ctx.Err()
+}
+
+// GetShortestPathToArticle : Takes two URLs and computes the shortest way to
+//                           get from one to the other through links
+func (c *Crawler) GetShortestPathToArticle(ctx context.Context) (*SearchResult, error) {
+	started := time.Now()
+	ctx, cancel := c.searchContext(ctx)
+	defer cancel()
+
+	if err := c.Resolve(ctx); err != nil {
+		return nil, err
+	}
+
+	budget := &errorBudget{limit: c.errorBudget, cancel: cancel}
+	tree, err := c.search(ctx, budget, false)
+	if err != nil {
+		c.logger.Warn("search stopped", "src", c.src, "dest", c.dest, "err", err)
+		return nil, err
+	}
+
+	result := newSearchResult(tree.firstPath(), tree.titles, tree.canonicals, tree.anchors, c.limit, tree.searchStats, started)
+	c.logResult(result)
+	return result, nil
+}
+
+// GetAllShortestPaths : Computes the sorted distinct shortest paths, at most maxPaths if it is positive
+func (c *Crawler) GetAllShortestPaths(ctx context.Context, maxPaths int) ([][]string, error) {
+	ctx, cancel := c.searchContext(ctx)
+	defer cancel()
+
+	if err := c.Resolve(ctx); err != nil {
+		return nil, err
+	}
 
-		links, _ = c.wikiParser.GetLinks(htm)
-		page = wikipage.NewWikiPageWithCrawlStatus(url, title, links, true)
-		c.dbService.AddPage(page)
+	budget := &errorBudget{limit: c.errorBudget, cancel: cancel}
+	tree, err := c.search(ctx, budget, true)
+	if err != nil {
+		return nil, err
 	}
 
-	for _, link := range links {
-		linkTitle, err := c.wikiParser.ExtractDocumentTitle(link)
-		if err != nil {
-			fmt.Println(err)
-			continue
+	return tree.allPaths(maxPaths), nil
+}
+
+// crawledPage : the result of fetching a single page of the frontier. The canonical URL differs
+// from the URL when the URL is a redirect, and the key identifies the page whatever its title
+type crawledPage struct {
+	url       string
+	canonical string
+	key       wikipage.PageKey
+	title     string
+	links     []parser.Link
+	cached    bool
+	err       error
+}
+
+// search : Runs a level-synchronous BFS from src, visiting pages by key, and returns its parent DAG
+func (c *Crawler) search(ctx context.Context, budget *errorBudget, findAll bool) (*searchTree, error) {
+	tree := newSearchTree(c.src)
+	tree.titles[c.dest] = c.destTitle
+	if c.src == c.dest {
+		tree.titles[c.src] = c.srcTitle
+		tree.targets = append(tree.targets, c.src)
+		return tree, nil
+	}
+
+	visited := newVisitedSet()
+	visited.addURL(c.src, 0)
+	visited.add(c.srcKey, c.src, 0)
+	frontier := []string{c.src}
+
+	for depth := 0; depth < c.limit && len(frontier) > 0; depth++ {
+		c.logger.Debug("expanding level", "depth", depth, "pages", len(frontier))
+		pages := c.expandFrontier(ctx, frontier, budget)
+		if err := budget.stopErr(ctx); err != nil {
+			return nil, &PartialResultError{Depth: depth, PagesVisited: tree.pagesFetched + tree.cacheHits, Err: err}
 		}
-		visited := false
 
-		for _, site := range history {
-			if linkTitle == site {
-				visited = true
+		for _, page := range pages {
+			tree.record(page)
+			if page.err != nil {
+				continue
+			}
+
+			tree.addPage(page)
+			if page.key == c.destKey || page.canonical == c.dest {
+				tree.targets = append(tree.targets, page.url)
+				if !findAll {
+					return tree, nil
+				}
 			}
 		}
 
-		if !visited {
-			wg.Add(1)
-			maxChan <- true
-			go c.crawl(link, path, maxDepth, wg, maxChan)
+		if len(tree.targets) != 0 {
+			return tree, nil
 		}
-	}
 
-	return
-}
+		next := make([]string, 0)
+		for _, page := range pages {
+			if page.err == nil && page.key != wikipage.KeyFromURL(page.url) {
+				if seen, first := visited.add(page.key, page.url, depth); !first {
+					if findAll && seen.depth == depth {
+						tree.mergeParents(page.url, seen.url)
+					}
+					continue
+				}
+			}
+
+			for _, link := range page.links {
+				if seen, first := visited.addURL(link.URL, depth+1); !first {
+					if findAll && seen.depth == depth+1 {
+						tree.addParent(seen.url, page.url, link)
+					}
+					continue
+				}
+
+				tree.addParent(link.URL, page.url, link)
+				if c.leadsToDest(link.URL) {
+					tree.titles[link.URL], tree.canonicals[link.URL] = c.destTitle, c.dest
+					tree.targets = append(tree.targets, link.URL)
+					if !findAll {
+						return tree, nil
+					}
+				}
+
+				next = append(next, link.URL)
+			}
+		}
 
-func (c *Crawler) updateShortestPath(path []string) {
-	c.mux.Lock()
-	if c.shortestPath != nil && len(c.shortestPath) != 0 {
-		if len(path) < len(c.shortestPath) {
-			c.shortestPath = path
+		if len(tree.targets) != 0 {
+			return tree, nil
 		}
-	} else {
-		c.shortestPath = path
+
+		frontier = next
 	}
-	c.mux.Unlock()
+
+	return tree, nil
+}
+
+// leadsToDest : Reports whether the link at the given URL leads to the destination, either
+// directly or through one of the redirects to it
+func (c *Crawler) leadsToDest(url string) bool {
+	return url == c.dest || c.destKeys[wikipage.KeyFromURL(url)]
 }
 
-func printPath(path []string) {
-	for _, site := range path {
-		fmt.Print(site + " -> ")
+// expandFrontier : Fetches the frontier concurrently, in order, spending the budget on failed pages
+func (c *Crawler) expandFrontier(ctx context.Context, frontier []string, budget *errorBudget) []crawledPage {
+	pages := make([]crawledPage, len(frontier))
+	maxChan := make(chan bool, c.concurrency)
+	var wg sync.WaitGroup
+
+	for index, url := range frontier {
+		wg.Add(1)
+		maxChan <- true
+		go func(index int, url string) {
+			defer wg.Done()
+			defer func() { <-maxChan }()
+
+			if err := ctx.Err(); err != nil {
+				pages[index] = crawledPage{url: url, err: err}
+				return
+			}
+
+			pages[index] = c.fetchPage(ctx, url)
+			budget.spend(ctx, pages[index].err)
+			c.logPage(pages[index])
+		}(index, url)
 	}
-	fmt.Println("")
+
+	wg.Wait()
+	return pages
 }
 
-func (c *Crawler) getHTMLFromURL(url string) (string, error) {
-	var result []byte
-	var err error
-	if c.isWebCrawler {
-		resp, err := c.netClient.Get(url)
+// fetchPage : Gets the parsed page at the given URL from Resolve, the db cache or a download
+func (c *Crawler) fetchPage(ctx context.Context, url string) crawledPage {
+	if page, resolved := c.resolved[url]; resolved {
+		return page
+	}
 
-		if err != nil {
-			return "", err
+	cachesLinks := c.dbService != nil && c.wikiParser.LinkMode() == parser.AllLinks
+	if cachesLinks {
+		canonical := c.dbService.GetRedirect(ctx, url)
+		if key := wikipage.KeyFromURL(canonical); c.crawledKeys[key] {
+			page := c.dbService.GetPage(ctx, key)
+			if page != nil && page.GetCrawledStatus() {
+				links := make([]parser.Link, 0, len(page.GetLinks()))
+				for _, link := range page.GetLinks() {
+					links = append(links, parser.Link{URL: link})
+				}
+
+				title := page.GetTitle()
+				if title == "" {
+					title = string(key)
+				}
+				return crawledPage{url: url, canonical: canonical, key: key, title: title, links: links, cached: true}
+			}
 		}
+	}
 
-		defer resp.Body.Close()
-		result, err = ioutil.ReadAll(resp.Body)
-
-		if err != nil {
-			return "", err
+	page := c.downloadPage(ctx, url, c.wikiParser)
+	if page.err == nil && cachesLinks {
+		if page.canonical != url {
+			c.dbService.AddRedirect(ctx, url, page.canonical)
 		}
-	} else {
-		result, err = ioutil.ReadFile(url)
 
-		if err != nil {
-			return "", err
+		urls := make([]string, 0, len(page.links))
+		for _, link := range page.links {
+			urls = append(urls, link.URL)
 		}
+		c.dbService.AddPage(ctx, wikipage.NewWikiPageWithKey(page.key, page.canonical, page.title, urls, true))
+	}
+
+	return page
+}
+
+// downloadPage : Fetches and parses the page at the given URL, streaming it if the fetcher can
+func (c *Crawler) downloadPage(ctx context.Context, url string, wikiParser *parser.Parser) crawledPage {
+	body, finalURL, err := fetcher.Stream(ctx, c.pageFetcher, url)
+	if err != nil {
+		return crawledPage{url: url, err: err}
+	}
+
+	defer body.Close()
+	parsed, err := wikiParser.ParseReaderWithBase(body, finalURL)
+	if err != nil {
+		return crawledPage{url: url, err: err}
+	}
+
+	title, links := parsed.Title, parsed.Links
+	if title == "" {
+		return crawledPage{url: url, err: errors.New("Error retrieving document " + url)}
+	}
+
+	// Without a canonical URL, the page is the one served after HTTP redirects
+	canonical := parsed.CanonicalURL
+	if canonical == "" {
+		canonical = normalize.URL(finalURL)
+	}
+
+	key := parsed.Key
+	if key == "" {
+		key = wikipage.KeyFromURL(canonical)
+	}
+
+	return crawledPage{url: url, canonical: canonical, key: key, title: title, links: links}
+}
+
+// logPage : Reports a fetched page, or why it couldn't be fetched, to the logger
+func (c *Crawler) logPage(page crawledPage) {
+	if errors.Is(page.err, fetcher.ErrDisallowedByRobots) {
+		c.logger.Debug("skipped page", "url", page.url, "reason", page.err)
+		return
+	}
+
+	if page.err != nil {
+		c.logger.Warn("fetching page failed", "url", page.url, "err", page.err)
+		return
+	}
+
+	c.logger.Debug("fetched page", "url", page.url, "key", page.key, "title", page.title, "links", len(page.links), "cached", page.cached)
+}
+
+// logResult : Reports the outcome of a search to the logger
+func (c *Crawler) logResult(result *SearchResult) {
+	c.logger.Info("search finished", "src", c.src, "dest", c.dest, "found", result.Found(), "depth", result.Depth,
+		"pagesFetched", result.PagesFetched, "cacheHits", result.CacheHits, "failedPages", result.FailedPages,
+		"skippedPages", result.SkippedPages, "elapsed", result.Elapsed)
+}
+
+// searchContext : Applies the crawler's timeout, if any, to the context of a search
+func (c *Crawler) searchContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(ctx, c.timeout)
 	}
 
-	return string(result), nil
+	return context.WithCancel(ctx)
 }
@@ -2,6 +2,21 @@ package crawler
 
 import (
 	"WikiGo/db"
+	"WikiGo/fetcher"
+	"WikiGo/logging"
+	"WikiGo/parser"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
 	"testing"
 	"time"
 )
@@ -10,44 +25,136 @@ import (
 type TestDBDriver struct {
 }
 
-func (td *TestDBDriver) PageExists(pageTitle string) bool {
+func (td *TestDBDriver) PageExists(ctx context.Context, pageTitle string) bool {
 	return false
 }
 
-func (td *TestDBDriver) RetrievePageID(pageTitle string) int {
+func (td *TestDBDriver) RetrievePageID(ctx context.Context, pageTitle string) int {
 	return -1
 }
 
-func (td *TestDBDriver) InsertPage(title string, url string, insertionTime time.Time) error {
+func (td *TestDBDriver) InsertPage(ctx context.Context, title string, url string, insertionTime time.Time) error {
 	return nil
 }
 
-func (td *TestDBDriver) InsertPageTitleOnly(title string, insertionTime time.Time) error {
+func (td *TestDBDriver) InsertPageTitleOnly(ctx context.Context, title string, insertionTime time.Time) error {
 	return nil
 }
 
-func (td *TestDBDriver) UpdatePageAsCrawled(title string, url string, insertionTime time.Time) error {
+func (td *TestDBDriver) InsertUncrawledPage(ctx context.Context, key string, url string, insertionTime time.Time) error {
 	return nil
 }
 
-func (td *TestDBDriver) InsertEdge(sourceID int, destID int) error {
+func (td *TestDBDriver) UpdatePageAsCrawled(ctx context.Context, key string, url string, displayTitle string, insertionTime time.Time) error {
 	return nil
 }
 
-func (td *TestDBDriver) RetrievePageLinks(pageTitle string) []string {
+func (td *TestDBDriver) InsertEdge(ctx context.Context, sourceID int, destID int) error {
 	return nil
 }
 
-func (td *TestDBDriver) RetrievePageURL(pageTitle string) string {
+func (td *TestDBDriver) RetrievePageLinks(ctx context.Context, pageTitle string) []string {
+	return nil
+}
+
+func (td *TestDBDriver) RetrievePageBacklinks(ctx context.Context, pageTitle string) []string {
+	return nil
+}
+
+func (td *TestDBDriver) RetrievePageURL(ctx context.Context, pageTitle string) string {
+	return ""
+}
+
+func (td *TestDBDriver) RetrieveAllPageTitles(ctx context.Context) []string {
+	return nil
+}
+
+func (td *TestDBDriver) RetrievePageInfo(ctx context.Context, key string) (string, string, bool, []string) {
+	return "", "", false, nil
+}
+
+func (td *TestDBDriver) InsertRedirect(ctx context.Context, alias string, target string) error {
+	return nil
+}
+
+func (td *TestDBDriver) RetrieveRedirectTarget(ctx context.Context, alias string) string {
 	return ""
 }
 
-func (td *TestDBDriver) RetrieveAllPageTitles() []string {
+func (td *TestDBDriver) RetrieveRedirectAliases(ctx context.Context, target string) []string {
 	return nil
 }
 
-func (td *TestDBDriver) RetrievePageInfo(title string) (string, bool, []string) {
-	return "", false, nil
+// TestRedirectDBDriver : A test DB driver that only knows the given redirects
+type TestRedirectDBDriver struct {
+	TestDBDriver
+	redirects map[string]string
+}
+
+func (td *TestRedirectDBDriver) RetrieveRedirectTarget(ctx context.Context, alias string) string {
+	return td.redirects[alias]
+}
+
+func (td *TestRedirectDBDriver) RetrieveRedirectAliases(ctx context.Context, target string) []string {
+	aliases := make([]string, 0)
+	for alias, aliasTarget := range td.redirects {
+		if aliasTarget == target {
+			aliases = append(aliases, alias)
+		}
+	}
+
+	return aliases
+}
+
+// TestRedirectSource : A redirect source that serves redirects from a map
+type TestRedirectSource map[string][]string
+
+func (ts TestRedirectSource) Redirects(ctx context.Context, url string) ([]string, error) {
+	return ts[url], nil
+}
+
+// TestBacklinkSource : A backlink source that serves backlinks from a map
+type TestBacklinkSource map[string][]string
+
+func (ts TestBacklinkSource) Backlinks(ctx context.Context, url string) ([]string, error) {
+	return ts[url], nil
+}
+
+// TestErrorBacklinkSource : A backlink source that always fails
+type TestErrorBacklinkSource struct {
+}
+
+func (ts TestErrorBacklinkSource) Backlinks(ctx context.Context, url string) ([]string, error) {
+	return nil, errors.New("no backlinks for " + url)
+}
+
+// TestTruncatedBacklinkSource : A backlink source that serves backlinks from a map, reporting
+// every list as truncated
+type TestTruncatedBacklinkSource map[string][]string
+
+func (ts TestTruncatedBacklinkSource) Backlinks(ctx context.Context, url string) ([]string, error) {
+	return ts[url], fmt.Errorf("%w: %s", ErrBacklinksTruncated, url)
+}
+
+var testBacklinks = TestBacklinkSource{
+	`./testHTML/page1.html`:      []string{`./testHTML/connectPage.html`, `./testHTML/cyclePage2.html`},
+	`./testHTML/page2.html`:      []string{`./testHTML/page1.html`},
+	`./testHTML/page3.html`:      []string{`./testHTML/page2.html`},
+	`./testHTML/page4.html`:      []string{`./testHTML/page3.html`, `./testHTML/connectPage.html`},
+	`./testHTML/cyclePage.html`:  []string{`./testHTML/cyclePage2.html`},
+	`./testHTML/cyclePage2.html`: []string{`./testHTML/cyclePage.html`},
+}
+
+func newTestCrawler(t *testing.T, src string, dest string, opts ...Option) *Crawler {
+	t.Helper()
+
+	defaults := []Option{WithFetcher(fetcher.NewFileFetcher("")), WithParser(parser.NewParser("", nil, nil, nil))}
+	myCrawler, err := NewCrawler(src, dest, append(defaults, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return myCrawler
 }
 
 func assertSameSlice(t *testing.T, result, expected []string) {
@@ -73,12 +180,13 @@ func assertSameSlice(t *testing.T, result, expected []string) {
 
 func TestGetHTMLReaderFromURL(t *testing.T) {
 	t.Run("Simple crawl with just 2 pages", func(t *testing.T) {
-		myCrawler := NewCrawler(`./testHTML/page1.html`,
+		myCrawler := newTestCrawler(t, `./testHTML/page1.html`,
 			`./testHTML/page2.html`,
-			"", nil, nil, nil, 3, false, db.NewDBService(&TestDBDriver{}))
+			WithMaxDepth(3), WithStore(db.NewDBService(&TestDBDriver{})))
 
 		expected := []string{"Page 1", "Page 2"}
-		path, err := myCrawler.GetShortestPathToArticle()
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+		path := result.Titles()
 
 		if err != nil {
 			t.Error(err)
@@ -88,12 +196,13 @@ func TestGetHTMLReaderFromURL(t *testing.T) {
 	})
 
 	t.Run("Test 3 pages", func(t *testing.T) {
-		myCrawler := NewCrawler(`./testHTML/page1.html`,
+		myCrawler := newTestCrawler(t, `./testHTML/page1.html`,
 			`./testHTML/page3.html`,
-			"", nil, nil, nil, 3, false, db.NewDBService(&TestDBDriver{}))
+			WithMaxDepth(3), WithStore(db.NewDBService(&TestDBDriver{})))
 
 		expected := []string{"Page 1", "Page 2", "Page 3"}
-		path, err := myCrawler.GetShortestPathToArticle()
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+		path := result.Titles()
 
 		if err != nil {
 			t.Error(err)
@@ -103,11 +212,12 @@ func TestGetHTMLReaderFromURL(t *testing.T) {
 	})
 
 	t.Run("Test depth limit", func(t *testing.T) {
-		myCrawler := NewCrawler(`./testHTML/page1.html`,
+		myCrawler := newTestCrawler(t, `./testHTML/page1.html`,
 			`./testHTML/page4.html`,
-			"", nil, nil, nil, 2, false, db.NewDBService(&TestDBDriver{}))
+			WithMaxDepth(2), WithStore(db.NewDBService(&TestDBDriver{})))
 
-		path, err := myCrawler.GetShortestPathToArticle()
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+		path := result.Titles()
 
 		if err != nil {
 			t.Error(err)
@@ -119,12 +229,13 @@ func TestGetHTMLReaderFromURL(t *testing.T) {
 	})
 
 	t.Run("Only report shortest path found", func(t *testing.T) {
-		myCrawler := NewCrawler(`./testHTML/connectPage.html`,
+		myCrawler := newTestCrawler(t, `./testHTML/connectPage.html`,
 			`./testHTML/page4.html`,
-			"", nil, nil, nil, 4, false, db.NewDBService(&TestDBDriver{}))
+			WithMaxDepth(4), WithStore(db.NewDBService(&TestDBDriver{})))
 
 		expected := []string{"ConnectPage", "Page 4"}
-		path, err := myCrawler.GetShortestPathToArticle()
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+		path := result.Titles()
 
 		if err != nil {
 			t.Error(err)
@@ -134,12 +245,63 @@ func TestGetHTMLReaderFromURL(t *testing.T) {
 	})
 
 	t.Run("Only report shortest path found", func(t *testing.T) {
-		myCrawler := NewCrawler(`./testHTML/cyclePage.html`,
+		myCrawler := newTestCrawler(t, `./testHTML/cyclePage.html`,
 			`./testHTML/page4.html`,
-			"", nil, nil, nil, 5, false, db.NewDBService(&TestDBDriver{}))
+			WithMaxDepth(5), WithStore(db.NewDBService(&TestDBDriver{})))
 
 		expected := []string{"CyclePage", "CyclePage2", "Page 1", "Page 2", "Page 3", "Page 4"}
-		path, err := myCrawler.GetShortestPathToArticle()
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+		path := result.Titles()
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		assertSameSlice(t, path, expected)
+	})
+	t.Run("Source is the destination", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/page1.html`,
+			`./testHTML/page1.html`,
+			WithMaxDepth(3), WithStore(db.NewDBService(&TestDBDriver{})))
+
+		expected := []string{"Page 1"}
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+		path := result.Titles()
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		assertSameSlice(t, path, expected)
+	})
+
+	t.Run("Crawl pages held in memory", func(t *testing.T) {
+		pages := fetcher.NewMapFetcher(map[string]string{
+			"/wiki/A": `<html><head><title>A</title></head><body><a href="/wiki/B">B</a></body></html>`,
+			"/wiki/B": `<html><head><title>B</title></head><body><a href="/wiki/C">C</a></body></html>`,
+			"/wiki/C": `<html><head><title>C</title></head><body></body></html>`,
+		})
+		myCrawler := newTestCrawler(t, "/wiki/A", "/wiki/C", WithMaxDepth(3), WithFetcher(pages))
+
+		expected := []string{"A", "B", "C"}
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+		path := result.Titles()
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		assertSameSlice(t, path, expected)
+	})
+
+	t.Run("Crawl without a db service", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/cyclePage.html`,
+			`./testHTML/page3.html`,
+			WithMaxDepth(4))
+
+		expected := []string{"CyclePage", "CyclePage2", "Page 1", "Page 2", "Page 3"}
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+		path := result.Titles()
 
 		if err != nil {
 			t.Error(err)
@@ -148,3 +310,1207 @@ func TestGetHTMLReaderFromURL(t *testing.T) {
 		assertSameSlice(t, path, expected)
 	})
 }
+
+// TestCountingFetcher : A fetcher that counts how often each URL is fetched
+type TestCountingFetcher struct {
+	fetcher fetcher.Fetcher
+	mux     sync.Mutex
+	counts  map[string]int
+}
+
+func NewTestCountingFetcher(f fetcher.Fetcher) *TestCountingFetcher {
+	return &TestCountingFetcher{fetcher: f, counts: make(map[string]int)}
+}
+
+func (tf *TestCountingFetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	tf.mux.Lock()
+	tf.counts[url]++
+	tf.mux.Unlock()
+
+	return tf.fetcher.Fetch(ctx, url)
+}
+
+func TestCycles(t *testing.T) {
+	assertFetchedOnce := func(t *testing.T, counts map[string]int, expected int) {
+		t.Helper()
+
+		for url, count := range counts {
+			if count != 1 {
+				t.Errorf("Expected '%s' to be fetched once but it was fetched %d times", url, count)
+			}
+		}
+
+		if len(counts) != expected {
+			t.Errorf("Expected %d pages to be fetched but got %v", expected, counts)
+		}
+	}
+
+	t.Run("Pages on a cycle are fetched once", func(t *testing.T) {
+		counted := NewTestCountingFetcher(fetcher.NewFileFetcher(""))
+		myCrawler := newTestCrawler(t, `./testHTML/cyclePage.html`, `./testHTML/diamondPage.html`,
+			WithMaxDepth(10), WithFetcher(counted))
+
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Found() {
+			t.Errorf("Expected no path but got '%q'", result.Titles())
+		}
+
+		assertFetchedOnce(t, counted.counts, 7)
+	})
+
+	t.Run("Finding every path fetches pages on a cycle once", func(t *testing.T) {
+		counted := NewTestCountingFetcher(fetcher.NewFileFetcher(""))
+		myCrawler := newTestCrawler(t, `./testHTML/cyclePage2.html`, `./testHTML/page4.html`,
+			WithMaxDepth(10), WithFetcher(counted), WithConcurrency(1))
+
+		paths, err := myCrawler.GetAllShortestPaths(context.Background(), 0)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := [][]string{[]string{"CyclePage2", "Page 1", "Page 2", "Page 3", "Page 4"}}
+		if !reflect.DeepEqual(paths, expected) {
+			t.Errorf("Expected '%q' but got '%q'", expected, paths)
+		}
+
+		assertFetchedOnce(t, counted.counts, 6)
+	})
+}
+
+func TestRedirects(t *testing.T) {
+	pages := map[string]string{
+		"/wiki/A": `<html><head><title>A</title></head><body><a href="/wiki/UK">UK</a>` +
+			`<a href="/wiki/United_Kingdom#History">history</a><a href="/wiki/united_Kingdom">the UK</a></body></html>`,
+		"/wiki/UK": `<html><head><title>United Kingdom</title><link rel="canonical" href="/wiki/United_Kingdom"></head>` +
+			`<body><a href="/wiki/C">C</a></body></html>`,
+		"/wiki/United_Kingdom": `<html><head><title>United Kingdom</title></head><body><a href="/wiki/C">C</a></body></html>`,
+		"/wiki/C":              `<html><head><title>C</title></head><body></body></html>`,
+	}
+
+	t.Run("Resolve redirects to their target", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, "/wiki/UK", "/wiki/c", WithFetcher(fetcher.NewMapFetcher(pages)))
+
+		if err := myCrawler.Resolve(context.Background()); err == nil {
+			t.Fatal("Expected the unnormalized destination to be fetched as given and be missing")
+		}
+
+		myCrawler = newTestCrawler(t, "/wiki/UK", "/wiki/C", WithFetcher(fetcher.NewMapFetcher(pages)))
+		if err := myCrawler.Resolve(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if myCrawler.src != "/wiki/United_Kingdom" {
+			t.Errorf("Expected the source to resolve to '/wiki/United_Kingdom' but got '%s'", myCrawler.src)
+		}
+	})
+
+	t.Run("Fragments, spellings and redirects are one page", func(t *testing.T) {
+		counted := NewTestCountingFetcher(fetcher.NewMapFetcher(pages))
+		myCrawler := newTestCrawler(t, "/wiki/A", "/wiki/C", WithMaxDepth(3), WithFetcher(counted), WithConcurrency(1))
+
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{"A", "United Kingdom", "C"}
+		if !reflect.DeepEqual(result.Titles(), expected) {
+			t.Errorf("Expected '%v' but got '%v'", expected, result.Titles())
+		}
+
+		if result.Hops[1].URL != "/wiki/United_Kingdom" {
+			t.Errorf("Expected the hop to have the canonical URL of the redirect but got '%s'", result.Hops[1].URL)
+		}
+
+		if counted.counts["/wiki/United_Kingdom"] != 1 || len(counted.counts) != 4 {
+			t.Errorf("Expected every page to be fetched under a single URL but got %v", counted.counts)
+		}
+	})
+
+	redirectingPages := map[string]string{
+		"/wiki/A":              `<html><head><title>A</title></head><body><a href="/wiki/UK">UK</a></body></html>`,
+		"/wiki/UK":             pages["/wiki/UK"],
+		"/wiki/United_Kingdom": pages["/wiki/United_Kingdom"],
+		"/wiki/C":              `<html><head><title>C</title></head><body><a href="/wiki/Dest_alias">dest</a></body></html>`,
+		"/wiki/Dest_alias": `<html><head><title>Dest</title><link rel="canonical" href="/wiki/Dest"></head>` +
+			`<body></body></html>`,
+		"/wiki/Dest": `<html><head><title>Dest</title></head><body></body></html>`,
+	}
+
+	t.Run("Redirect to the destination at the last level", func(t *testing.T) {
+		counted := NewTestCountingFetcher(fetcher.NewMapFetcher(redirectingPages))
+		redirects := TestRedirectSource{"/wiki/Dest": []string{"/wiki/Dest_alias"}}
+		myCrawler := newTestCrawler(t, "/wiki/A", "/wiki/Dest", WithMaxDepth(3), WithFetcher(counted),
+			WithRedirectSource(redirects))
+
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{"A", "United Kingdom", "C", "Dest"}
+		if !reflect.DeepEqual(result.Titles(), expected) || result.Depth != 3 {
+			t.Errorf("Expected '%v' at depth 3 but got '%v' at depth %d", expected, result.Titles(), result.Depth)
+		}
+
+		if result.Hops[1].URL != "/wiki/United_Kingdom" || result.Hops[3].URL != "/wiki/Dest" {
+			t.Errorf("Expected the hops to have canonical URLs but got %+v", result.Hops)
+		}
+
+		if counted.counts["/wiki/Dest_alias"] != 0 {
+			t.Errorf("Expected the redirect to be matched without fetching it but got %v", counted.counts)
+		}
+
+		myCrawler = newTestCrawler(t, "/wiki/A", "/wiki/Dest", WithMaxDepth(3),
+			WithFetcher(fetcher.NewMapFetcher(redirectingPages)), WithRedirectSource(redirects))
+		paths, err := myCrawler.GetAllShortestPaths(context.Background(), 0)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(paths, [][]string{expected}) {
+			t.Errorf("Expected '%v' but got '%v'", [][]string{expected}, paths)
+		}
+	})
+
+	t.Run("Don't fetch the last level", func(t *testing.T) {
+		counted := NewTestCountingFetcher(fetcher.NewMapFetcher(redirectingPages))
+		myCrawler := newTestCrawler(t, "/wiki/A", "/wiki/Dest", WithMaxDepth(2), WithFetcher(counted))
+
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Found() {
+			t.Errorf("Expected no path but got '%q'", result.Titles())
+		}
+
+		if counted.counts["/wiki/C"] != 0 {
+			t.Errorf("Expected the pages of the last level not to be fetched but got %v", counted.counts)
+		}
+	})
+
+	t.Run("Redirect to the destination known to the db", func(t *testing.T) {
+		counted := NewTestCountingFetcher(fetcher.NewMapFetcher(redirectingPages))
+		driver := &TestRedirectDBDriver{redirects: map[string]string{"/wiki/Dest_alias": "/wiki/Dest"}}
+		myCrawler := newTestCrawler(t, "/wiki/A", "/wiki/Dest", WithMaxDepth(3), WithFetcher(counted),
+			WithStore(db.NewDBService(driver)))
+
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Depth != 3 || result.Hops[3].URL != "/wiki/Dest" || result.Hops[3].Title != "Dest" ||
+			counted.counts["/wiki/Dest_alias"] != 0 {
+			t.Errorf("Expected the redirect to be found without fetching it but got %+v after %v", result, counted.counts)
+		}
+	})
+}
+
+func TestPageKeys(t *testing.T) {
+	pages := map[string]string{
+		"/wiki/A": `<html><head><title>A</title><script>RLCONF={"wgPageName":"A"};</script></head>` +
+			`<body><a href="/wiki/Decoy">decoy</a><a href="/wiki/B">B</a></body></html>`,
+		"/wiki/Decoy": `<html><head><title>Lawrence Daly - Wikipedia</title><script>RLCONF={"wgPageName":"Decoy"};</script></head>` +
+			`<body></body></html>`,
+		"/wiki/B": `<html><head><title>B</title></head><body><a href="/wiki/Daly_the_miner">the miner</a></body></html>`,
+		"/wiki/Daly_the_miner": `<html><head><title>Lawrence Daly – Wikipédia</title>` +
+			`<script>RLCONF={"wgPageName":"Lawrence_Daly","wgTitle":"Lawrence Daly"};</script></head><body></body></html>`,
+		"/wiki/Lawrence_Daly": `<html><head><title>Lawrence Daly - Wikipedia</title>` +
+			`<script>RLCONF={"wgPageName":"Lawrence_Daly"};</script></head><body></body></html>`,
+	}
+
+	t.Run("Match the destination by key rather than title text", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, "/wiki/A", "/wiki/Lawrence_Daly", WithMaxDepth(3),
+			WithFetcher(fetcher.NewMapFetcher(pages)), WithConcurrency(1))
+
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{"A", "B", "Lawrence Daly"}
+		if !reflect.DeepEqual(result.Titles(), expected) {
+			t.Errorf("Expected '%v' but got '%v'", expected, result.Titles())
+		}
+
+		if url := result.Hops[len(result.Hops)-1].URL; url != "/wiki/Daly_the_miner" {
+			t.Errorf("Expected the path to end at '/wiki/Daly_the_miner' but got '%s'", url)
+		}
+	})
+}
+
+func TestSearchResult(t *testing.T) {
+	t.Run("Report hops and statistics", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/connectPage.html`, `./testHTML/page3.html`, WithMaxDepth(3))
+
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []Hop{
+			Hop{Title: "ConnectPage", URL: `./testHTML/connectPage.html`},
+			Hop{Title: "Page 1", URL: `./testHTML/page1.html`, AnchorText: "Link!"},
+			Hop{Title: "Page 2", URL: `./testHTML/page2.html`, AnchorText: "Link!"},
+			Hop{Title: "Page 3", URL: `./testHTML/page3.html`, AnchorText: "Link!"},
+		}
+
+		if !reflect.DeepEqual(result.Hops, expected) {
+			t.Errorf("Expected '%v' but got '%v'", expected, result.Hops)
+		}
+
+		if result.Depth != 3 || result.PagesFetched != 4 || result.CacheHits != 0 || !result.Exhaustive {
+			t.Errorf("Expected depth 3 with 4 pages fetched exhaustively but got %+v", result)
+		}
+	})
+
+	t.Run("Failed pages make the search not exhaustive", func(t *testing.T) {
+		pages := fetcher.NewMapFetcher(map[string]string{
+			"/wiki/A": `<html><head><title>A</title></head><body><a href="/wiki/Missing">?</a></body></html>`,
+			"/wiki/C": `<html><head><title>C</title></head><body></body></html>`,
+		})
+		var logs bytes.Buffer
+		logger := logging.NewStdLogger(log.New(&logs, "", 0), logging.LevelWarn)
+		myCrawler := newTestCrawler(t, "/wiki/A", "/wiki/C", WithMaxDepth(3), WithFetcher(pages), WithLogger(logger))
+
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Found() || result.Exhaustive || result.FailedPages != 1 || result.Depth != 3 {
+			t.Errorf("Expected no path and 1 failed page but got %+v", result)
+		}
+
+		expected := "WARN fetching page failed url=/wiki/Missing err=page not found\n"
+		if logs.String() != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, logs.String())
+		}
+	})
+
+	t.Run("Stop the search once the error budget is spent", func(t *testing.T) {
+		pages := fetcher.NewMapFetcher(map[string]string{
+			"/wiki/A": `<html><head><title>A</title></head><body><a href="/wiki/X">X</a><a href="/wiki/Y">Y</a>` +
+				`<a href="/wiki/Z">Z</a></body></html>`,
+			"/wiki/C": `<html><head><title>C</title></head><body></body></html>`,
+		})
+		myCrawler := newTestCrawler(t, "/wiki/A", "/wiki/C", WithMaxDepth(3), WithFetcher(pages),
+			WithConcurrency(1), WithErrorBudget(2))
+
+		_, err := myCrawler.GetShortestPathToArticle(context.Background())
+
+		var partial *PartialResultError
+		if !errors.As(err, &partial) || !errors.Is(err, ErrErrorBudgetExceeded) {
+			t.Fatalf("Expected a partial result stopped by the error budget but got '%v'", err)
+		}
+
+		if partial.Depth != 1 {
+			t.Errorf("Expected the search to stop after 1 level but got %d", partial.Depth)
+		}
+	})
+
+	t.Run("Pages disallowed by robots.txt are skipped", func(t *testing.T) {
+		pages := fetcher.NewRobotsFetcher(fetcher.NewMapFetcher(map[string]string{
+			"/robots.txt": "User-agent: *\nDisallow: /wiki/B\n",
+			"/wiki/A":     `<html><head><title>A</title></head><body><a href="/wiki/B">B</a></body></html>`,
+			"/wiki/B":     `<html><head><title>B</title></head><body><a href="/wiki/C">C</a></body></html>`,
+			"/wiki/C":     `<html><head><title>C</title></head><body></body></html>`,
+		}), DefaultUserAgent)
+		myCrawler := newTestCrawler(t, "/wiki/A", "/wiki/C", WithMaxDepth(3), WithFetcher(pages))
+
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Found() || result.SkippedPages != 1 || result.FailedPages != 0 || result.Exhaustive {
+			t.Errorf("Expected no path and 1 skipped page, not exhaustively, but got %+v", result)
+		}
+	})
+}
+
+func TestNewCrawler(t *testing.T) {
+	t.Run("Defaults for Wikipedia", func(t *testing.T) {
+		myCrawler, err := NewCrawler("https://en.wikipedia.org/wiki/Fife", "https://en.wikipedia.org/wiki/Lawrence_Daly")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if myCrawler.limit != DefaultMaxDepth || myCrawler.concurrency != DefaultConcurrency {
+			t.Errorf("Expected depth %d and concurrency %d but got %d and %d",
+				DefaultMaxDepth, DefaultConcurrency, myCrawler.limit, myCrawler.concurrency)
+		}
+
+		if _, obeysRobots := myCrawler.pageFetcher.(*fetcher.RobotsFetcher); !obeysRobots {
+			t.Errorf("Expected the default HTTP fetcher obeying robots.txt but got %T", myCrawler.pageFetcher)
+		}
+	})
+
+	t.Run("Contact details in the User-Agent", func(t *testing.T) {
+		userAgents := make(chan string, 3)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case userAgents <- r.UserAgent():
+			default:
+			}
+			fmt.Fprint(w, `<html><head><title>Page</title></head><body></body></html>`)
+		}))
+		defer server.Close()
+
+		myCrawler, err := NewCrawler(server.URL+"/wiki/Src", server.URL+"/wiki/Dest", WithContact("me@example.com"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := myCrawler.Resolve(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		expected := DefaultUserAgent + " (me@example.com)"
+		if userAgent := <-userAgents; userAgent != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, userAgent)
+		}
+	})
+
+	invalid := map[string][]Option{
+		"Negative depth":                []Option{WithMaxDepth(-1)},
+		"No concurrency":                []Option{WithConcurrency(0)},
+		"Too much concurrency":          []Option{WithConcurrency(FileLimit + 1)},
+		"Negative timeout":              []Option{WithTimeout(-time.Second)},
+		"User agent for custom fetcher": []Option{WithFetcher(fetcher.NewFileFetcher("")), WithUserAgent("test")},
+		"Contact for custom fetcher":    []Option{WithFetcher(fetcher.NewFileFetcher("")), WithContact("me@example.com")},
+		"Host limits for custom fetcher": []Option{WithFetcher(fetcher.NewFileFetcher("")),
+			WithHostLimits(fetcher.HostLimits{RequestsPerSecond: 1})},
+		"Negative host limits":             []Option{WithHostLimits(fetcher.HostLimits{MaxConns: -1})},
+		"Negative max body size":           []Option{WithMaxBodySize(-1)},
+		"Max body size for custom fetcher": []Option{WithFetcher(fetcher.NewFileFetcher("")), WithMaxBodySize(1)},
+		"Negative error budget":            []Option{WithErrorBudget(-1)},
+		"Retry policy without attempts":    []Option{WithRetryPolicy(fetcher.RetryPolicy{})},
+		"Retry policy for custom fetcher": []Option{WithFetcher(fetcher.NewFileFetcher("")),
+			WithRetryPolicy(fetcher.RetryPolicy{MaxAttempts: 1})},
+		"Robots for custom fetcher": []Option{WithFetcher(fetcher.NewFileFetcher("")), WithRobots(false)},
+	}
+
+	for name, opts := range invalid {
+		opts := opts
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewCrawler(`./testHTML/page1.html`, `./testHTML/page2.html`, opts...); err == nil {
+				t.Error("Expected the options to be rejected")
+			}
+		})
+	}
+
+	t.Run("Missing destination", func(t *testing.T) {
+		if _, err := NewCrawler(`./testHTML/page1.html`, ""); err == nil {
+			t.Error("Expected a missing destination to be rejected")
+		}
+	})
+
+	t.Run("Rejected options don't create the cache", func(t *testing.T) {
+		parent, err := ioutil.TempDir("", "crawler")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(parent)
+
+		dir := filepath.Join(parent, "cache")
+		_, err = NewCrawler(`./testHTML/page1.html`, `./testHTML/page2.html`,
+			WithHTTPCache(dir, DefaultCachePolicy), WithLinkMode(parser.LinkMode(-1)))
+
+		if err == nil {
+			t.Error("Expected the options to be rejected")
+		}
+
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("Expected no cache directory but got '%v'", err)
+		}
+	})
+}
+
+func TestResolve(t *testing.T) {
+	t.Run("Creating a crawler fetches nothing", func(t *testing.T) {
+		pages := NewTestCountingFetcher(fetcher.NewFileFetcher(""))
+		newTestCrawler(t, `./testHTML/page1.html`, `./testHTML/page2.html`, WithMaxDepth(3), WithFetcher(pages))
+
+		if len(pages.counts) != 0 {
+			t.Errorf("Expected no fetches but got %v", pages.counts)
+		}
+	})
+
+	t.Run("Missing source page", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/missing.html`,
+			`./testHTML/page2.html`,
+			WithMaxDepth(3))
+
+		err := myCrawler.Resolve(context.Background())
+
+		if !errors.Is(err, ErrSourceNotFound) {
+			t.Errorf("Expected '%v' but got '%v'", ErrSourceNotFound, err)
+		}
+
+		if !os.IsNotExist(errors.Unwrap(err)) {
+			t.Errorf("Expected a not exist error but got '%v'", errors.Unwrap(err))
+		}
+	})
+
+	t.Run("Missing destination page", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/page1.html`,
+			`./testHTML/missing.html`,
+			WithMaxDepth(3))
+
+		_, err := myCrawler.GetShortestPathToArticle(context.Background())
+
+		if !errors.Is(err, ErrDestinationNotFound) {
+			t.Errorf("Expected '%v' but got '%v'", ErrDestinationNotFound, err)
+		}
+	})
+
+	t.Run("Follow redirects to the canonical page", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/wiki/Src":
+				fmt.Fprint(w, `<html><head><title>Src</title></head><body><a href="/wiki/Dest">Link!</a></body></html>`)
+			case "/wiki/Dest":
+				fmt.Fprint(w, `<html><head><title>Dest</title></head><body></body></html>`)
+			default:
+				http.Redirect(w, r, "/wiki/Dest", http.StatusMovedPermanently)
+			}
+		}))
+		defer server.Close()
+
+		myCrawler := newTestCrawler(t, server.URL+"/wiki/Src", server.URL+"/wiki/Dest_alias", WithMaxDepth(3), WithFetcher(fetcher.NewHTTPFetcher(server.Client())), WithParser(parser.NewParser(server.URL, nil, nil, nil)))
+
+		if err := myCrawler.Resolve(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if myCrawler.dest != server.URL+"/wiki/Dest" {
+			t.Errorf("Expected '%q' but got '%q'", server.URL+"/wiki/Dest", myCrawler.dest)
+		}
+
+		expected := []string{"Src", "Dest"}
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+		path := result.Titles()
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		assertSameSlice(t, path, expected)
+	})
+}
+
+func TestGetAllShortestPaths(t *testing.T) {
+	t.Run("Find every path of the same length", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/diamondPage.html`,
+			`./testHTML/page4.html`,
+			WithMaxDepth(4), WithStore(db.NewDBService(&TestDBDriver{})))
+
+		expected := [][]string{
+			[]string{"DiamondPage", "DiamondLeft", "Page 4"},
+			[]string{"DiamondPage", "DiamondRight", "Page 4"},
+		}
+		paths, err := myCrawler.GetAllShortestPaths(context.Background(), 0)
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		if !reflect.DeepEqual(paths, expected) {
+			t.Errorf("Expected '%q' but got '%q'", expected, paths)
+		}
+	})
+
+	t.Run("Find the paths through every URL of a page", func(t *testing.T) {
+		pages := map[string]string{
+			"/wiki/S": `<html><head><title>S</title></head><body><a href="/wiki/A">A</a><a href="/wiki/B">B</a></body></html>`,
+			"/wiki/A": `<html><head><title>A</title></head><body><a href="/wiki/M_alias">M</a></body></html>`,
+			"/wiki/B": `<html><head><title>B</title></head><body><a href="/wiki/M">M</a></body></html>`,
+			"/wiki/M_alias": `<html><head><title>M</title><link rel="canonical" href="/wiki/M"></head>` +
+				`<body><a href="/wiki/D">D</a></body></html>`,
+			"/wiki/M": `<html><head><title>M</title></head><body><a href="/wiki/D">D</a></body></html>`,
+			"/wiki/D": `<html><head><title>D</title></head><body></body></html>`,
+		}
+		myCrawler := newTestCrawler(t, "/wiki/S", "/wiki/D", WithMaxDepth(3),
+			WithFetcher(fetcher.NewMapFetcher(pages)), WithConcurrency(1))
+
+		expected := [][]string{
+			[]string{"S", "A", "M", "D"},
+			[]string{"S", "B", "M", "D"},
+		}
+		paths, err := myCrawler.GetAllShortestPaths(context.Background(), 0)
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		if !reflect.DeepEqual(paths, expected) {
+			t.Errorf("Expected '%q' but got '%q'", expected, paths)
+		}
+	})
+
+	t.Run("Cap the number of paths", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/diamondPage.html`,
+			`./testHTML/page4.html`,
+			WithMaxDepth(4), WithStore(db.NewDBService(&TestDBDriver{})))
+
+		expected := [][]string{[]string{"DiamondPage", "DiamondLeft", "Page 4"}}
+		paths, err := myCrawler.GetAllShortestPaths(context.Background(), 1)
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		if !reflect.DeepEqual(paths, expected) {
+			t.Errorf("Expected '%q' but got '%q'", expected, paths)
+		}
+	})
+
+	t.Run("No paths within depth", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/diamondPage.html`,
+			`./testHTML/page4.html`,
+			WithMaxDepth(1), WithStore(db.NewDBService(&TestDBDriver{})))
+
+		paths, err := myCrawler.GetAllShortestPaths(context.Background(), 0)
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		if len(paths) != 0 {
+			t.Errorf("Expected no paths but got '%q'", paths)
+		}
+	})
+
+	t.Run("Cancelled search", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/diamondPage.html`,
+			`./testHTML/page4.html`,
+			WithMaxDepth(4), WithStore(db.NewDBService(&TestDBDriver{})))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err := myCrawler.GetAllShortestPaths(ctx, 0)
+
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected '%v' but got '%v'", context.Canceled, err)
+		}
+	})
+}
+
+func TestSearchTimeout(t *testing.T) {
+	t.Run("Stop slow fetches at the deadline", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/src":
+				fmt.Fprint(w, `<html><head><title>Src</title></head><body><a href="/slow">Link!</a></body></html>`)
+			case "/dest":
+				fmt.Fprint(w, `<html><head><title>Dest</title></head><body></body></html>`)
+			default:
+				<-r.Context().Done()
+			}
+		}))
+		defer server.Close()
+
+		myCrawler := newTestCrawler(t, server.URL+"/src", server.URL+"/dest", WithMaxDepth(3), WithFetcher(fetcher.NewHTTPFetcher(server.Client())), WithParser(parser.NewParser(server.URL, nil, nil, nil)),
+			WithTimeout(50*time.Millisecond))
+
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+		path := result.Titles()
+
+		var partial *PartialResultError
+		if !errors.As(err, &partial) {
+			t.Fatalf("Expected a partial result error but got '%v'", err)
+		}
+
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected '%v' but got '%v'", context.DeadlineExceeded, err)
+		}
+
+		if partial.Depth != 1 || partial.PagesVisited != 1 {
+			t.Errorf("Expected 1 level and 1 page explored but got %d and %d", partial.Depth, partial.PagesVisited)
+		}
+
+		if path != nil {
+			t.Errorf("Expected no path but got '%q'", path)
+		}
+	})
+
+	t.Run("Fetches stopped at the deadline don't spend the error budget", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/src":
+				fmt.Fprint(w, `<html><head><title>Src</title></head><body><a href="/slow">Link!</a></body></html>`)
+			case "/dest":
+				fmt.Fprint(w, `<html><head><title>Dest</title></head><body></body></html>`)
+			default:
+				<-r.Context().Done()
+			}
+		}))
+		defer server.Close()
+
+		myCrawler := newTestCrawler(t, server.URL+"/src", server.URL+"/dest", WithMaxDepth(3),
+			WithFetcher(fetcher.NewHTTPFetcher(server.Client())), WithParser(parser.NewParser(server.URL, nil, nil, nil)),
+			WithTimeout(50*time.Millisecond), WithErrorBudget(1))
+
+		_, err := myCrawler.GetShortestPathToArticle(context.Background())
+
+		if !errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrErrorBudgetExceeded) {
+			t.Errorf("Expected '%v' but got '%v'", context.DeadlineExceeded, err)
+		}
+	})
+}
+
+func TestGetShortestPathBidirectional(t *testing.T) {
+	t.Run("Searches meet in the middle", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/cyclePage.html`,
+			`./testHTML/page4.html`,
+			WithMaxDepth(5), WithStore(db.NewDBService(&TestDBDriver{})))
+
+		expected := []string{"CyclePage", "CyclePage2", "Page 1", "Page 2", "Page 3", "Page 4"}
+		result, err := myCrawler.GetShortestPathBidirectional(context.Background(), testBacklinks)
+		path := result.Titles()
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		assertSameSlice(t, path, expected)
+	})
+
+	t.Run("Only report shortest path found", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/connectPage.html`,
+			`./testHTML/page4.html`,
+			WithMaxDepth(4), WithStore(db.NewDBService(&TestDBDriver{})))
+
+		expected := []string{"ConnectPage", "Page 4"}
+		result, err := myCrawler.GetShortestPathBidirectional(context.Background(), testBacklinks)
+		path := result.Titles()
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		assertSameSlice(t, path, expected)
+	})
+
+	t.Run("Hops after the meeting node have their link context", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/diamondPage.html`,
+			`./testHTML/page4.html`,
+			WithMaxDepth(4), WithStore(db.NewDBService(&TestDBDriver{})))
+
+		result, err := myCrawler.GetShortestPathBidirectional(context.Background(), testBacklinks)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertSameSlice(t, result.Titles(), []string{"DiamondPage", "Page 2", "Page 3", "Page 4"})
+		for _, hop := range result.Hops[1:] {
+			if hop.AnchorText != "Link!" {
+				t.Errorf("Test Failed: expected anchor text Link! for %s, got %q", hop.URL, hop.AnchorText)
+			}
+		}
+	})
+
+	t.Run("Truncated backlink lists are followed but aren't exhaustive", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/diamondPage.html`,
+			`./testHTML/page4.html`,
+			WithMaxDepth(4), WithErrorBudget(1), WithStore(db.NewDBService(&TestDBDriver{})))
+
+		// The lists leave out diamondLeft.html and diamondRight.html, so the shorter paths through
+		// them are missed
+		backlinks := TestTruncatedBacklinkSource{
+			`./testHTML/page4.html`: []string{`./testHTML/page3.html`},
+			`./testHTML/page3.html`: []string{`./testHTML/page2.html`},
+		}
+
+		expected := []string{"DiamondPage", "Page 2", "Page 3", "Page 4"}
+		result, err := myCrawler.GetShortestPathBidirectional(context.Background(), backlinks)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertSameSlice(t, result.Titles(), expected)
+		if result.Exhaustive || result.FailedPages != 0 {
+			t.Errorf("Test Failed: expected a non-exhaustive result without failed pages, got %+v", result)
+		}
+	})
+
+	t.Run("Searches meet on any URL of a page", func(t *testing.T) {
+		pages := map[string]string{
+			"/wiki/S": `<html><head><title>S</title></head><body><a href="/wiki/Dest_alias">dest</a></body></html>`,
+			"/wiki/Dest_alias": `<html><head><title>Dest</title><link rel="canonical" href="/wiki/Dest"></head>` +
+				`<body></body></html>`,
+			"/wiki/Dest": `<html><head><title>Dest</title></head><body></body></html>`,
+		}
+
+		myCrawler := newTestCrawler(t, "/wiki/S", "/wiki/Dest", WithMaxDepth(2),
+			WithFetcher(fetcher.NewMapFetcher(pages)))
+		result, err := myCrawler.GetShortestPathBidirectional(context.Background(), TestBacklinkSource{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{"S", "Dest"}
+		assertSameSlice(t, result.Titles(), expected)
+		if result.Depth != 1 || result.Hops[1].URL != "/wiki/Dest" {
+			t.Errorf("Expected the path to end at '/wiki/Dest' at depth 1 but got %+v", result)
+		}
+
+		redirects := TestRedirectSource{"/wiki/Dest": []string{"/wiki/Dest_alias"}}
+		myCrawler = newTestCrawler(t, "/wiki/S", "/wiki/Dest", WithMaxDepth(1),
+			WithFetcher(fetcher.NewMapFetcher(pages)), WithRedirectSource(redirects))
+		result, err = myCrawler.GetShortestPathBidirectional(context.Background(), TestBacklinkSource{})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertSameSlice(t, result.Titles(), expected)
+	})
+
+	t.Run("Test depth limit", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, `./testHTML/page1.html`,
+			`./testHTML/page4.html`,
+			WithMaxDepth(2), WithStore(db.NewDBService(&TestDBDriver{})))
+
+		result, err := myCrawler.GetShortestPathBidirectional(context.Background(), testBacklinks)
+		path := result.Titles()
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		if path != nil {
+			t.Error("Test Failed: Should not return a path since depth is too low")
+		}
+	})
+}
+
+func TestBacklinkSources(t *testing.T) {
+	t.Run("Parse WhatLinksHere page", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/wiki/Special:WhatLinksHere/Lawrence_Daly" {
+				http.NotFound(w, r)
+				return
+			}
+
+			fmt.Fprint(w, `<html><body>
+<a href="/wiki/Main_Page">Main page</a>
+<ul id="mw-whatlinkshere-list">
+<li><a href="/wiki/Arthur_Scargill">Arthur Scargill</a> (<a href="/wiki/Special:WhatLinksHere/Arthur_Scargill">links</a>)</li>
+<li><a href="/wiki/Fife">Fife</a></li>
+</ul>
+</body></html>`)
+		}))
+		defer server.Close()
+
+		wikiParser := parser.NewParser(server.URL, []string{"/wiki/"}, []string{"Special:"}, nil)
+		source := NewWhatLinksHereSource(server.URL, wikiParser, fetcher.NewHTTPFetcher(server.Client()))
+
+		expected := []string{server.URL + "/wiki/Arthur_Scargill", server.URL + "/wiki/Fife"}
+		result, err := source.Backlinks(context.Background(), server.URL+"/wiki/Lawrence_Daly#Career")
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		assertSameSlice(t, result, expected)
+	})
+
+	t.Run("Follow WhatLinksHere pagination", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/wiki/Special:WhatLinksHere/Lawrence_Daly" {
+				fmt.Fprint(w, `<html><body>
+<ul id="mw-whatlinkshere-list"><li><a href="/wiki/Arthur_Scargill">Arthur Scargill</a></li></ul>
+(previous 500 | <a href="/w/index.php?title=Special:WhatLinksHere/Lawrence_Daly&amp;limit=500&amp;from=12&amp;back=0"
+class="mw-nextlink">next 500</a>)
+</body></html>`)
+				return
+			}
+
+			if r.URL.Path != "/w/index.php" || r.URL.Query().Get("title") != "Special:WhatLinksHere/Lawrence_Daly" {
+				http.NotFound(w, r)
+				return
+			}
+
+			switch r.URL.Query().Get("from") {
+			case "12":
+				fmt.Fprint(w, `<html><body>
+<ul id="mw-whatlinkshere-list"><li><a href="/wiki/Fife">Fife</a></li></ul>
+(<a href="/w/index.php?title=Special:WhatLinksHere/Lawrence_Daly&amp;limit=500&amp;dir=prev&amp;from=12">previous 500</a> |
+<a href="/w/index.php?title=Special:WhatLinksHere/Lawrence_Daly&amp;limit=500&amp;from=34&amp;back=12">next 500</a>)
+</body></html>`)
+			case "34":
+				fmt.Fprint(w, `<html><body>
+<ul id="mw-whatlinkshere-list"><li><a href="/wiki/National_Union_of_Mineworkers">NUM</a></li></ul>
+(<a href="/w/index.php?title=Special:WhatLinksHere/Lawrence_Daly&amp;limit=500&amp;dir=prev&amp;from=34">previous 500</a> | next 500)
+</body></html>`)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer server.Close()
+
+		wikiParser := parser.NewParser(server.URL, []string{"/wiki/"}, []string{"Special:"}, nil)
+		source := NewWhatLinksHereSource(server.URL, wikiParser, fetcher.NewHTTPFetcher(server.Client()))
+
+		expected := []string{server.URL + "/wiki/Arthur_Scargill", server.URL + "/wiki/Fife",
+			server.URL + "/wiki/National_Union_of_Mineworkers"}
+		result, err := source.Backlinks(context.Background(), server.URL+"/wiki/Lawrence_Daly")
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		assertSameSlice(t, result, expected)
+
+		limited := NewWhatLinksHereSourceWithMaxPages(server.URL, wikiParser, fetcher.NewHTTPFetcher(server.Client()), 2)
+		result, err = limited.Backlinks(context.Background(), server.URL+"/wiki/Lawrence_Daly")
+
+		if !errors.Is(err, ErrBacklinksTruncated) {
+			t.Errorf("Test Failed: expected ErrBacklinksTruncated, got %v", err)
+		}
+
+		assertSameSlice(t, result, expected[:2])
+	})
+
+	t.Run("Chain falls back to next source", func(t *testing.T) {
+		failing := TestErrorBacklinkSource{}
+		empty := TestBacklinkSource{}
+		source := ChainBacklinkSources(failing, empty, testBacklinks)
+
+		expected := []string{`./testHTML/page3.html`, `./testHTML/connectPage.html`}
+		result, err := source.Backlinks(context.Background(), `./testHTML/page4.html`)
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		assertSameSlice(t, result, expected)
+	})
+
+	t.Run("Chain keeps truncated backlinks", func(t *testing.T) {
+		source := ChainBacklinkSources(TestTruncatedBacklinkSource(testBacklinks), TestBacklinkSource{})
+
+		expected := []string{`./testHTML/page3.html`, `./testHTML/connectPage.html`}
+		result, err := source.Backlinks(context.Background(), `./testHTML/page4.html`)
+
+		if !errors.Is(err, ErrBacklinksTruncated) {
+			t.Errorf("Test Failed: expected ErrBacklinksTruncated, got %v", err)
+		}
+
+		assertSameSlice(t, result, expected)
+	})
+
+	t.Run("List backlinks with the MediaWiki API", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			if r.URL.Path != "/w/api.php" || query.Get("bltitle") != "Lawrence Daly" || query.Get("blfilterredir") != "nonredirects" {
+				http.NotFound(w, r)
+				return
+			}
+
+			switch query.Get("blcontinue") {
+			case "":
+				fmt.Fprint(w, `{"continue":{"blcontinue":"0|12","continue":"-||"},"query":{"backlinks":[{"ns":0,"title":"Fife"}]}}`)
+			case "0|12":
+				fmt.Fprint(w, `{"continue":{"blcontinue":"0|34","continue":"-||"},"query":{"backlinks":[{"ns":0,"title":"Arthur Scargill"}]}}`)
+			default:
+				fmt.Fprint(w, `{"query":{"backlinks":[{"ns":0,"title":"National Union of Mineworkers"}]}}`)
+			}
+		}))
+		defer server.Close()
+
+		source := NewMediaWikiAPIWithMaxRequests(server.URL, fetcher.NewHTTPFetcher(server.Client()), 2)
+
+		expected := []string{server.URL + "/wiki/Fife", server.URL + "/wiki/Arthur_Scargill"}
+		result, err := source.Backlinks(context.Background(), server.URL+"/wiki/Lawrence_Daly")
+
+		if !errors.Is(err, ErrBacklinksTruncated) {
+			t.Errorf("Expected '%v' but got '%v'", ErrBacklinksTruncated, err)
+		}
+
+		assertSameSlice(t, result, expected)
+	})
+}
+func TestRedirectSources(t *testing.T) {
+	t.Run("List redirects with the MediaWiki API", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			query := r.URL.Query()
+			if r.URL.Path != "/w/api.php" || query.Get("list") != "backlinks" || query.Get("bltitle") != "United Kingdom" ||
+				query.Get("blfilterredir") != "redirects" || query.Get("blnamespace") != "0" {
+				http.NotFound(w, r)
+				return
+			}
+
+			switch query.Get("blcontinue") {
+			case "":
+				fmt.Fprint(w, `{"continue":{"blcontinue":"0|12","continue":"-||"},"query":{"backlinks":[{"pageid":1,"ns":0,"title":"UK","redirect":true}]}}`)
+			case "0|12":
+				fmt.Fprint(w, `{"batchcomplete":true,"query":{"backlinks":[{"pageid":2,"ns":0,"title":"Royaume-Uni de Grande-Bretagne","redirect":true}]}}`)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer server.Close()
+
+		source := NewMediaWikiAPI(server.URL, fetcher.NewHTTPFetcher(server.Client()))
+
+		expected := []string{server.URL + "/wiki/UK", server.URL + "/wiki/Royaume-Uni_de_Grande-Bretagne"}
+		result, err := source.Redirects(context.Background(), server.URL+"/wiki/United_Kingdom")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertSameSlice(t, result, expected)
+	})
+
+	t.Run("Ask the API of the wiki the article is on", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"query":{"backlinks":[{"ns":0,"title":"UK"}]}}`)
+		}))
+		defer server.Close()
+
+		source := NewMediaWikiAPI("https://en.wikipedia.org", fetcher.NewHTTPFetcher(server.Client()))
+		result, err := source.Redirects(context.Background(), server.URL+"/wiki/United_Kingdom")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertSameSlice(t, result, []string{server.URL + "/wiki/UK"})
+	})
+
+	t.Run("Report API errors", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"error":{"code":"invalidtitle","info":"Bad title"}}`)
+		}))
+		defer server.Close()
+
+		source := NewMediaWikiAPI(server.URL, fetcher.NewHTTPFetcher(server.Client()))
+
+		if _, err := source.Redirects(context.Background(), server.URL+"/wiki/United_Kingdom"); err == nil {
+			t.Error("Expected the API error to be returned")
+		}
+	})
+
+	t.Run("Merge the redirects of every source", func(t *testing.T) {
+		driver := &TestRedirectDBDriver{redirects: map[string]string{"/wiki/UK": "/wiki/United_Kingdom"}}
+		source := MergeRedirectSources(NewDBRedirectSource(db.NewDBService(driver)),
+			TestRedirectSource{"/wiki/United_Kingdom": []string{"/wiki/GB"}})
+
+		result, err := source.Redirects(context.Background(), "/wiki/United_Kingdom")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertSameSlice(t, result, []string{"/wiki/UK", "/wiki/GB"})
+	})
+}
+
+func TestNewWikipediaParser(t *testing.T) {
+	htm := `<html><body><a href="/wiki/Fife">Fife</a><a href="/wiki/X-File:_The_Movie">film</a>
+<a href="/wiki/File:Fife.jpg">map</a><a href="/wiki/Special:Random">random</a><a href="/wiki/Wikipedia:About">about</a>
+<a href="https://upload.wikimedia.org/fife.jpg">photo</a></body></html>`
+
+	t.Run("Follow articles outside of excluded namespaces", func(t *testing.T) {
+		result, err := NewWikipediaParser(DefaultDomain).GetLinks(htm)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{DefaultDomain + "/wiki/Fife", DefaultDomain + "/wiki/X-File:_The_Movie"}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("Skip navboxes and references of articles", func(t *testing.T) {
+		article := `<html><body><div id="mw-content-text"><div class="mw-parser-output">
+<div role="note" class="hatnote">See also: <a href="/wiki/Fife_whistle">Fife whistle</a></div>
+<p>Fife borders <a href="/wiki/Perth_and_Kinross">Perth and Kinross</a>.</p>
+<div class="reflist"><a href="/wiki/Reference">ref</a></div>
+<div class="navbox"><a href="/wiki/Angus">Angus</a></div>
+</div></div><div id="catlinks"><a href="/wiki/Category:Fife">Fife</a></div></body></html>`
+		result, err := NewWikipediaParser(DefaultDomain).GetLinks(article)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{DefaultDomain + "/wiki/Perth_and_Kinross"}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("Replace the filter", func(t *testing.T) {
+		filter := parser.NewRuleFilter(parser.Exclude,
+			parser.Rule{Action: parser.Include, Matcher: parser.MatchPrefix("/wiki/Special:")})
+		result, err := NewWikipediaParser(DefaultDomain, parser.WithLinkFilter(filter)).GetLinks(htm)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{DefaultDomain + "/wiki/Special:Random"}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+}
+
+func TestFollowFirstLink(t *testing.T) {
+	pages := map[string]string{
+		"/wiki/Fife": `<html><head><title>Fife</title></head><body><table><tr><td><a href="/wiki/Map">map</a></td></tr></table>` +
+			`<p>Fife (<a href="/wiki/Scots_language">Scots</a>: Fìfe) lies north of the <i><a href="/wiki/Forth">Forth</a></i> ` +
+			`in <a href="/wiki/Scotland">Scotland</a>.</p></body></html>`,
+		"/wiki/Scotland": `<html><head><title>Scotland</title><script>RLCONF={"wgPageName":"Scotland"};</script></head>` +
+			`<body><p>Scotland is a <a href="/wiki/Country">country</a>.</p></body></html>`,
+		"/wiki/Country": `<html><head><title>Country</title></head>` +
+			`<body><h2>Examples</h2><p>Such as <a href="/wiki/Scotland_country">Scotland</a>.</p></body></html>`,
+		"/wiki/Scotland_country": `<html><head><title>Scotland</title><script>RLCONF={"wgPageName":"Scotland"};</script></head>` +
+			`<body><p>Scotland is a <a href="/wiki/Country">country</a>.</p></body></html>`,
+		"/wiki/Forth": `<html><head><title>Forth</title></head><body><p>(<a href="/wiki/River">River</a>)</p></body></html>`,
+	}
+	myCrawler := newTestCrawler(t, "/wiki/Fife", "/wiki/Scotland", WithFetcher(fetcher.NewMapFetcher(pages)),
+		WithParser(parser.NewParser("", []string{"/wiki/"}, nil, nil)))
+
+	t.Run("Report the loop", func(t *testing.T) {
+		result, err := myCrawler.FollowFirstLink(context.Background(), "/wiki/Fife", 0)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []Hop{
+			Hop{Title: "Fife", URL: "/wiki/Fife"},
+			Hop{Title: "Scotland", URL: "/wiki/Scotland", AnchorText: "Scotland"},
+			Hop{Title: "Country", URL: "/wiki/Country", AnchorText: "country"},
+			Hop{Title: "Scotland", URL: "/wiki/Scotland_country", AnchorText: "Scotland", Section: "Examples"},
+		}
+		if !reflect.DeepEqual(result.Hops, expected) {
+			t.Errorf("Expected '%+v' but got '%+v'", expected, result.Hops)
+		}
+
+		if !result.Looped() || result.LoopStart != 1 || len(result.Loop()) != 2 || result.DeadEnd || result.Steps() != 3 {
+			t.Errorf("Expected a loop through Scotland and Country but got %+v", result)
+		}
+	})
+
+	t.Run("Stop at a dead end", func(t *testing.T) {
+		result, err := myCrawler.FollowFirstLink(context.Background(), "/wiki/Forth", 0)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !result.DeadEnd || result.Looped() || result.Steps() != 0 {
+			t.Errorf("Expected the parenthesized link not to be followed but got %+v", result)
+		}
+	})
+
+	t.Run("Stop after the steps", func(t *testing.T) {
+		result, err := myCrawler.FollowFirstLink(context.Background(), "/wiki/Fife", 1)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Steps() != 1 || result.Looped() || result.DeadEnd || result.PagesFetched != 2 {
+			t.Errorf("Expected one link to be followed but got %+v", result)
+		}
+	})
+
+	t.Run("Missing start page", func(t *testing.T) {
+		_, err := myCrawler.FollowFirstLink(context.Background(), "/wiki/Nowhere", 0)
+
+		if !errors.Is(err, ErrSourceNotFound) {
+			t.Errorf("Expected ErrSourceNotFound but got %v", err)
+		}
+	})
+
+	t.Run("Stop downloading a streamed page after its first link", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/wiki/Endless":
+				fmt.Fprint(w, `<html><head><title>Endless</title></head><body><p><a href="/wiki/End">end</a></p>`)
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+			case "/wiki/End":
+				fmt.Fprint(w, `<html><head><title>End</title></head><body></body></html>`)
+			default:
+				http.NotFound(w, r)
+			}
+		}))
+		defer server.Close()
+
+		streaming := newTestCrawler(t, server.URL+"/wiki/Endless", server.URL+"/wiki/End",
+			WithFetcher(fetcher.NewHTTPFetcher(server.Client())), WithTimeout(5*time.Second),
+			WithParser(parser.NewParser(server.URL, []string{"/wiki/"}, nil, nil)))
+
+		result, err := streaming.FollowFirstLink(context.Background(), server.URL+"/wiki/Endless", 0)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !result.DeadEnd || result.Steps() != 1 || result.Elapsed > time.Second {
+			t.Errorf("Expected the endless page to be left after its first link but got %+v", result)
+		}
+	})
+}
+
+func TestLinkModes(t *testing.T) {
+	pages := map[string]string{
+		"/wiki/A": `<html><head><title>A</title></head><body><p><a href="/wiki/B">B</a></p>` +
+			`<h2>See also</h2><p><a href="/wiki/C">C</a></p></body></html>`,
+		"/wiki/B": `<html><head><title>B</title></head><body></body></html>`,
+		"/wiki/C": `<html><head><title>C</title></head><body></body></html>`,
+	}
+
+	t.Run("Only follow links in the lead", func(t *testing.T) {
+		myCrawler := newTestCrawler(t, "/wiki/A", "/wiki/C", WithFetcher(fetcher.NewMapFetcher(pages)),
+			WithLinkMode(parser.LeadLinks))
+		result, err := myCrawler.GetShortestPathToArticle(context.Background())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Found() {
+			t.Errorf("Expected no path through the See also section but got %v", result.Titles())
+		}
+	})
+
+	t.Run("Reject unknown modes", func(t *testing.T) {
+		if _, err := NewCrawler("/wiki/A", "/wiki/C", WithLinkMode(parser.LinkMode(7))); err == nil {
+			t.Error("Expected the link mode to be rejected")
+		}
+	})
+}
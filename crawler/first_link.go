@@ -0,0 +1,106 @@
+package crawler
+
+import (
+	"WikiGo/parser"
+	"WikiGo/wikipage"
+	"context"
+	"time"
+)
+
+// FirstLinkResult : the pages reached by following the first link of every page from a start
+// page, as in the "Getting to Philosophy" game
+type FirstLinkResult struct {
+	// Hops holds the pages in the order they were reached, from the start page on, with the link
+	// followed to each. If the path loops, the last hop is the page it loops back to
+	Hops []Hop
+	// LoopStart is the index in Hops of the page the path loops back to, or -1 if it doesn't loop
+	LoopStart int
+	// DeadEnd reports whether the path stopped at a page without a link to follow
+	DeadEnd      bool
+	PagesFetched int
+	Elapsed      time.Duration
+}
+
+// Looped : Reports whether the path came back to a page it had already reached
+func (r *FirstLinkResult) Looped() bool {
+	return r != nil && r.LoopStart >= 0
+}
+
+// Loop : Gets the pages of the loop the path ended in, in the order they were reached, or
+// nothing if it didn't loop
+func (r *FirstLinkResult) Loop() []Hop {
+	if !r.Looped() {
+		return nil
+	}
+
+	return r.Hops[r.LoopStart : len(r.Hops)-1]
+}
+
+// Steps : Gets the number of links followed
+func (r *FirstLinkResult) Steps() int {
+	if r == nil || len(r.Hops) == 0 {
+		return 0
+	}
+
+	return len(r.Hops) - 1
+}
+
+// FollowFirstLink : Starts at the page at the given URL and follows the first link of every page,
+// as the parser's FirstLink mode finds it, until a page is reached a second time, a page has no
+// link to follow, or maxSteps links have been followed if it is positive. Pages are told apart by
+// key, so a loop through a redirect is still found. The crawler's fetcher and parser are used,
+// but neither its source and destination nor the db cache, whose links have no context. Fetching
+// the start page fails with a ResolveError, and later pages with a PartialResultError
+func (c *Crawler) FollowFirstLink(ctx context.Context, start string, maxSteps int) (*FirstLinkResult, error) {
+	started := time.Now()
+	ctx, cancel := c.searchContext(ctx)
+	defer cancel()
+
+	firstLinkParser := c.wikiParser.With(parser.WithLinkMode(parser.FirstLink))
+	result := FirstLinkResult{LoopStart: -1}
+	reached := make(map[wikipage.PageKey]int)
+	url := start
+	followed := parser.Link{}
+
+	for {
+		page := c.downloadPage(ctx, url, firstLinkParser)
+		c.logPage(page)
+		if page.err != nil {
+			if len(result.Hops) == 0 {
+				return nil, &ResolveError{Endpoint: ErrSourceNotFound, URL: start, Err: page.err}
+			}
+			return nil, &PartialResultError{Depth: result.Steps(), PagesVisited: result.PagesFetched, Err: page.err}
+		}
+
+		result.PagesFetched++
+		result.Hops = append(result.Hops, Hop{
+			Title:      page.title,
+			URL:        page.canonical,
+			AnchorText: followed.Text,
+			Section:    followed.Section,
+		})
+
+		if index, seen := reached[page.key]; seen {
+			result.LoopStart = index
+			break
+		}
+		reached[page.key] = len(result.Hops) - 1
+
+		if len(page.links) == 0 {
+			result.DeadEnd = true
+			break
+		}
+
+		if maxSteps > 0 && result.Steps() >= maxSteps {
+			break
+		}
+
+		followed = page.links[0]
+		url = followed.URL
+	}
+
+	result.Elapsed = time.Since(started)
+	c.logger.Info("first link path finished", "start", start, "steps", result.Steps(), "looped", result.Looped(),
+		"deadEnd", result.DeadEnd, "elapsed", result.Elapsed)
+	return &result, nil
+}
@@ -0,0 +1,378 @@
+package crawler
+
+import (
+	"WikiGo/db"
+	"WikiGo/fetcher"
+	"WikiGo/logging"
+	"WikiGo/parser"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// Defaults used by NewCrawler when no option overrides them, suited to crawling English Wikipedia
+const (
+	DefaultDomain      = "https://en.wikipedia.org"
+	DefaultMaxDepth    = 3
+	DefaultConcurrency = 15
+	DefaultUserAgent   = "WikiGo/1.0"
+	DefaultMaxBodySize = 16 << 20
+
+	// DefaultMaxAPIRequests : how many requests of 500 pages the default MediaWiki API source
+	// makes for a list of backlinks or redirects before it stops
+	DefaultMaxAPIRequests = 10
+)
+
+// DefaultHostLimits : politeness limits of the default fetcher, keeping well within what Wikimedia
+// allows a single client. Requests the server asked to back off from are retried by the retry
+// policy rather than by the limits
+var DefaultHostLimits = fetcher.HostLimits{
+	RequestsPerSecond: 10,
+	Burst:             10,
+	MaxConns:          5,
+}
+
+// DefaultRetryPolicy : how the default fetcher retries pages that failed to fetch for transient reasons
+var DefaultRetryPolicy = fetcher.RetryPolicy{
+	MaxAttempts:    4,
+	BaseDelay:      500 * time.Millisecond,
+	MaxDelay:       30 * time.Second,
+	AttemptTimeout: 30 * time.Second,
+}
+
+// DefaultCachePolicy : a starting point for the policy given to WithHTTPCache, which the command
+// line uses with its --cache-ttl. WithHTTPCache doesn't fall back to it, as a zero policy means
+// following max-age without a size limit
+var DefaultCachePolicy = fetcher.CachePolicy{
+	TTL:      time.Hour,
+	MaxBytes: 512 << 20,
+}
+
+// DefaultPatterns : link prefixes followed on Wikipedia, i.e. articles
+var DefaultPatterns = []string{"/wiki/"}
+
+// DefaultExcludedNamespaces : numbers of the Wikipedia namespaces whose pages aren't followed,
+// i.e. special, project, file, help and book pages
+var DefaultExcludedNamespaces = []int{-1, 4, 6, 12, 108}
+
+// DefaultExcludedExtensions : extensions of Wikipedia links that lead to files, not articles
+var DefaultExcludedExtensions = []string{".jpg"}
+
+// DefaultContentSelector : the element holding the article body on Wikipedia pages
+const DefaultContentSelector = "#mw-content-text .mw-parser-output"
+
+// DefaultExcludedSelectors : the parts of Wikipedia articles whose links aren't about the article
+// itself: navigation boxes, references, infoboxes, categories and hatnotes, and the edit links
+// of section headings, which would otherwise be part of the section names of links
+var DefaultExcludedSelectors = []string{".navbox", ".reflist", ".references", ".infobox", "#catlinks", ".hatnote", ".mw-editsection"}
+
+// DefaultContentScope : Creates the content scope of Wikipedia articles, from DefaultContentSelector
+// and DefaultExcludedSelectors
+func DefaultContentScope() *parser.ContentScope {
+	return parser.MustNewContentScope(DefaultContentSelector, DefaultExcludedSelectors...)
+}
+
+// DefaultLinkFilter : Creates the filter of the links followed on Wikipedia: links matching
+// DefaultPatterns, except for pages in DefaultExcludedNamespaces and files with
+// DefaultExcludedExtensions
+func DefaultLinkFilter() *parser.RuleFilter {
+	namespaces := parser.MatchNamespace(parser.DefaultNamespaces(), DefaultExcludedNamespaces...)
+	return parser.NewRuleFilter(parser.Exclude,
+		parser.Rule{Action: parser.Exclude, Matcher: namespaces},
+		parser.Rule{Action: parser.Exclude, Matcher: parser.MatchExtension(DefaultExcludedExtensions...)},
+		parser.Rule{Action: parser.Include, Matcher: parser.MatchPrefix(DefaultPatterns...)},
+	)
+}
+
+// NewWikipediaParser : Creates a parser for the Wikipedia site at the given domain, filtering
+// links with DefaultLinkFilter and taking them from DefaultContentScope unless the options give
+// another filter or scope
+func NewWikipediaParser(domain string, opts ...parser.Option) *parser.Parser {
+	defaults := []parser.Option{parser.WithLinkFilter(DefaultLinkFilter()), parser.WithContentScope(DefaultContentScope())}
+	return parser.NewParser(domain, nil, nil, nil, append(defaults, opts...)...)
+}
+
+// Option : configures a Crawler created with NewCrawler
+type Option func(*config)
+
+type config struct {
+	maxDepth    int
+	concurrency int
+	timeout     time.Duration
+	pageFetcher fetcher.Fetcher
+	dbService   *db.Service
+	redirects   RedirectSource
+	backlinks   BacklinkSource
+	wikiParser  *parser.Parser
+	linkMode    parser.LinkMode
+	userAgent   string
+	contact     string
+	hostLimits  fetcher.HostLimits
+	retryPolicy fetcher.RetryPolicy
+	robots      bool
+	cacheDir    string
+	cachePolicy fetcher.CachePolicy
+	maxBodySize int64
+	decoders    map[string]fetcher.Decoder
+	errorBudget int
+	logger      logging.Logger
+}
+
+// WithMaxDepth : Sets the maximum number of links a path may follow
+func WithMaxDepth(maxDepth int) Option {
+	return func(c *config) { c.maxDepth = maxDepth }
+}
+
+// WithConcurrency : Sets how many pages may be fetched at once, at most FileLimit
+func WithConcurrency(concurrency int) Option {
+	return func(c *config) { c.concurrency = concurrency }
+}
+
+// WithTimeout : Sets a deadline for every search run by the crawler. A search that runs out of
+// time stops all of its fetches and returns a PartialResultError. Zero means no deadline
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *config) { c.timeout = timeout }
+}
+
+// WithFetcher : Sets the fetcher pages are retrieved with, instead of the default HTTP fetcher
+func WithFetcher(pageFetcher fetcher.Fetcher) Option {
+	return func(c *config) { c.pageFetcher = pageFetcher }
+}
+
+// WithStore : Sets the db service crawled pages are cached in. By default nothing is cached
+func WithStore(dbService *db.Service) Option {
+	return func(c *config) { c.dbService = dbService }
+}
+
+// WithRedirectSource : Sets where redirects to the destination are listed, instead of the db and API
+func WithRedirectSource(redirects RedirectSource) Option {
+	return func(c *config) { c.redirects = redirects }
+}
+
+// WithBacklinkSource : Sets the backlink source of bidirectional searches, instead of the db and API
+func WithBacklinkSource(backlinks BacklinkSource) Option {
+	return func(c *config) { c.backlinks = backlinks }
+}
+
+// WithParser : Sets the parser used to find titles and links, instead of the English Wikipedia parser
+func WithParser(wikiParser *parser.Parser) Option {
+	return func(c *config) { c.wikiParser = wikiParser }
+}
+
+// WithLinkMode : Sets which links of each page are followed, e.g. only those in the lead section,
+// on top of the parser's other settings. Pages aren't cached in the db unless every link is followed
+func WithLinkMode(mode parser.LinkMode) Option {
+	return func(c *config) { c.linkMode = mode }
+}
+
+// WithLogger : Sets the logger that crawl progress and failed fetches are reported to. By default
+// nothing is logged
+func WithLogger(logger logging.Logger) Option {
+	return func(c *config) { c.logger = logger }
+}
+
+// WithUserAgent : Sets the User-Agent header sent by the default HTTP fetcher
+func WithUserAgent(userAgent string) Option {
+	return func(c *config) { c.userAgent = userAgent }
+}
+
+// WithContact : Adds contact details, such as an email address or the URL of a project page,
+// to the User-Agent header sent by the default HTTP fetcher, as the Wikimedia User-Agent
+// policy asks of crawlers
+func WithContact(contact string) Option {
+	return func(c *config) { c.contact = contact }
+}
+
+// WithRetryPolicy : Sets how the default HTTP fetcher retries transient failures instead of
+// DefaultRetryPolicy
+func WithRetryPolicy(policy fetcher.RetryPolicy) Option {
+	return func(c *config) { c.retryPolicy = policy }
+}
+
+// WithErrorBudget : Sets how many pages a search may fail to fetch before it gives up and returns
+// a PartialResultError matching ErrErrorBudgetExceeded. Zero means no budget
+func WithErrorBudget(errorBudget int) Option {
+	return func(c *config) { c.errorBudget = errorBudget }
+}
+
+// WithHTTPCache : Makes the default HTTP fetcher keep the pages it downloads in the given
+// directory, so that later searches, even by other crawlers, can reuse or cheaply revalidate them.
+// The cache reads every page whole to store it, so pages are no longer parsed as they download
+func WithHTTPCache(dir string, policy fetcher.CachePolicy) Option {
+	return func(c *config) {
+		c.cacheDir = dir
+		c.cachePolicy = policy
+	}
+}
+
+// WithMaxBodySize : Sets the largest page, once decompressed, the default HTTP fetcher reads
+// instead of DefaultMaxBodySize. Larger pages fail with a fetcher.BodyTooLargeError. Zero means
+// no limit
+func WithMaxBodySize(maxBodySize int64) Option {
+	return func(c *config) { c.maxBodySize = maxBodySize }
+}
+
+// WithDecoder : Makes the default HTTP fetcher accept responses compressed with the given
+// Content-Encoding, on top of gzip and deflate, and decode them with the given decoder
+func WithDecoder(encoding string, decoder fetcher.Decoder) Option {
+	return func(c *config) {
+		if c.decoders == nil {
+			c.decoders = fetcher.DefaultDecoders()
+		}
+		c.decoders[encoding] = decoder
+	}
+}
+
+// WithRobots : Sets whether the default HTTP fetcher obeys the robots.txt of the wiki, which it
+// does by default. Pages robots.txt disallows are skipped and counted in SearchResult.SkippedPages
+func WithRobots(robots bool) Option {
+	return func(c *config) { c.robots = robots }
+}
+
+// WithHostLimits : Sets the per-host politeness limits of the default HTTP fetcher instead of
+// DefaultHostLimits
+func WithHostLimits(limits fetcher.HostLimits) Option {
+	return func(c *config) { c.hostLimits = limits }
+}
+
+func defaultConfig() config {
+	return config{
+		maxDepth:    DefaultMaxDepth,
+		concurrency: DefaultConcurrency,
+		hostLimits:  DefaultHostLimits,
+		retryPolicy: DefaultRetryPolicy,
+		maxBodySize: DefaultMaxBodySize,
+		robots:      true,
+		logger:      logging.NewNopLogger(),
+	}
+}
+
+// validate : Checks the options, without building anything from them
+func (c *config) validate() error {
+	if c.maxDepth < 0 {
+		return errors.New("max depth can't be negative")
+	}
+
+	if c.concurrency < 1 || c.concurrency > FileLimit {
+		return errors.New("concurrency must be between 1 and FileLimit")
+	}
+
+	if c.logger == nil {
+		return errors.New("logger can't be nil")
+	}
+
+	if c.timeout < 0 {
+		return errors.New("timeout can't be negative")
+	}
+
+	if c.errorBudget < 0 {
+		return errors.New("error budget can't be negative")
+	}
+
+	if c.retryPolicy.MaxAttempts < 1 || c.retryPolicy.BaseDelay < 0 || c.retryPolicy.MaxDelay < 0 ||
+		c.retryPolicy.AttemptTimeout < 0 {
+		return errors.New("retry policy needs at least one attempt and no negative delays")
+	}
+
+	if c.hostLimits.RequestsPerSecond < 0 || c.hostLimits.Burst < 0 || c.hostLimits.MaxConns < 0 ||
+		c.hostLimits.MaxRetries < 0 || c.hostLimits.MaxRetryAfter < 0 {
+		return errors.New("host limits can't be negative")
+	}
+
+	if c.pageFetcher != nil && (c.userAgent != "" || c.contact != "") {
+		return errors.New("user agent only applies to the default fetcher")
+	}
+
+	if c.pageFetcher != nil && c.hostLimits != DefaultHostLimits {
+		return errors.New("host limits only apply to the default fetcher")
+	}
+
+	if c.pageFetcher != nil && c.retryPolicy != DefaultRetryPolicy {
+		return errors.New("retry policy only applies to the default fetcher")
+	}
+
+	if c.pageFetcher != nil && c.cacheDir != "" {
+		return errors.New("http cache only applies to the default fetcher")
+	}
+
+	if c.cachePolicy.TTL < 0 || c.cachePolicy.MaxBytes < 0 || c.cachePolicy.MaxBodySize < 0 {
+		return errors.New("cache policy can't be negative")
+	}
+
+	if c.maxBodySize < 0 {
+		return errors.New("max body size can't be negative")
+	}
+
+	if c.pageFetcher != nil && (c.maxBodySize != DefaultMaxBodySize || c.decoders != nil) {
+		return errors.New("max body size and decoders only apply to the default fetcher")
+	}
+
+	if c.pageFetcher != nil && !c.robots {
+		return errors.New("robots.txt only applies to the default fetcher")
+	}
+
+	if c.linkMode < parser.AllLinks || c.linkMode > parser.FirstLink {
+		return errors.New("unknown link mode")
+	}
+
+	return nil
+}
+
+// newHTTPFetchers : Builds the default fetcher from the HTTP options, creating the cache directory
+// if there is one, and the fetcher of the MediaWiki API, which is the same but ignores robots.txt
+func (c *config) newHTTPFetchers() (fetcher.Fetcher, fetcher.Fetcher, error) {
+	userAgent := c.userAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent
+	}
+	if c.contact != "" {
+		userAgent += " (" + c.contact + ")"
+	}
+
+	var transport http.RoundTripper = fetcher.NewDecompressTransport(fetcher.NewTransport(), c.decoders)
+	if c.cacheDir != "" {
+		policy := c.cachePolicy
+		if policy.MaxBodySize == 0 {
+			policy.MaxBodySize = c.maxBodySize
+		}
+		cache, err := fetcher.NewCacheTransport(c.cacheDir, transport, policy)
+		if err != nil {
+			return nil, nil, err
+		}
+		transport = cache
+	}
+
+	netClient := &http.Client{Transport: transport}
+	httpFetcher := fetcher.NewHTTPFetcherWithMaxBodySize(netClient, userAgent, c.maxBodySize)
+	apiFetcher := fetcher.NewRetryFetcher(fetcher.NewPoliteFetcher(httpFetcher, c.hostLimits), c.retryPolicy)
+	if !c.robots {
+		return apiFetcher, apiFetcher, nil
+	}
+
+	return fetcher.NewRobotsFetcher(apiFetcher, userAgent), apiFetcher, nil
+}
+
+// sources : Gets the redirect and backlink sources, defaulting to the db, if there is one, and the
+// MediaWiki API at the given domain, if there is an API fetcher
+func (c *config) sources(domain string, apiFetcher fetcher.Fetcher) (RedirectSource, BacklinkSource) {
+	redirects, backlinks := c.redirects, c.backlinks
+	redirectSources, backlinkSources := make([]RedirectSource, 0), make([]BacklinkSource, 0)
+	if c.dbService != nil {
+		redirectSources = append(redirectSources, NewDBRedirectSource(c.dbService))
+		backlinkSources = append(backlinkSources, NewDBBacklinkSource(c.dbService))
+	}
+	if apiFetcher != nil {
+		api := NewMediaWikiAPIWithMaxRequests(domain, apiFetcher, DefaultMaxAPIRequests)
+		redirectSources = append(redirectSources, api)
+		backlinkSources = append(backlinkSources, api)
+	}
+
+	if redirects == nil {
+		redirects = MergeRedirectSources(redirectSources...)
+	}
+	if backlinks == nil {
+		backlinks = ChainBacklinkSources(backlinkSources...)
+	}
+
+	return redirects, backlinks
+}
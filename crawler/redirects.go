@@ -0,0 +1,53 @@
+package crawler
+
+import (
+	"WikiGo/db"
+	"context"
+)
+
+// RedirectSource : interface for listing the pages that redirect to a given page, so that links to
+// them are known to lead to the destination without fetching them
+type RedirectSource interface {
+	Redirects(ctx context.Context, url string) ([]string, error)
+}
+
+// DBRedirectSource : Redirect source that reads the redirects recorded in the db while crawling
+type DBRedirectSource struct {
+	dbService *db.Service
+}
+
+// NewDBRedirectSource : Creates a redirect source backed by the given db service
+func NewDBRedirectSource(dbService *db.Service) *DBRedirectSource {
+	return &DBRedirectSource{dbService: dbService}
+}
+
+// Redirects : Gets the URLs of the crawled pages that redirect to the given URL
+func (s *DBRedirectSource) Redirects(ctx context.Context, url string) ([]string, error) {
+	return s.dbService.GetRedirectAliases(ctx, url), nil
+}
+
+// mergedRedirectSource : Redirect source that lists the redirects known to any of its sources
+type mergedRedirectSource struct {
+	sources []RedirectSource
+}
+
+// MergeRedirectSources : Combines redirect sources so that every redirect any of them knows of is
+// listed, e.g. those recorded in the db and those the MediaWiki API knows of
+func MergeRedirectSources(sources ...RedirectSource) RedirectSource {
+	return &mergedRedirectSource{sources: sources}
+}
+
+// Redirects : Gets the redirects listed by every source, with the last error of a source that failed
+func (s *mergedRedirectSource) Redirects(ctx context.Context, url string) ([]string, error) {
+	var lastErr error
+	redirects := make([]string, 0)
+	for _, source := range s.sources {
+		aliases, err := source.Redirects(ctx, url)
+		if err != nil {
+			lastErr = err
+		}
+		redirects = append(redirects, aliases...)
+	}
+
+	return redirects, lastErr
+}
@@ -0,0 +1,119 @@
+package crawler
+
+import (
+	"WikiGo/fetcher"
+	"WikiGo/parser"
+	"errors"
+	"time"
+)
+
+// Hop : a page on a path, with the text of the link that was followed to reach it and the
+// section of the previous page the link is in, empty if it is in the lead or isn't known
+type Hop struct {
+	Title      string
+	URL        string
+	AnchorText string
+	Section    string
+}
+
+// SearchResult : the outcome of a search, with the path found and what it cost to find it
+type SearchResult struct {
+	// Hops holds the pages of the path from the source to the destination, or nothing if no path was found
+	Hops []Hop
+	// Depth is the number of links on the path, or the depth searched if no path was found
+	Depth        int
+	PagesFetched int
+	CacheHits    int
+	FailedPages  int
+	// SkippedPages counts the pages that weren't fetched because robots.txt disallows them
+	SkippedPages int
+	Elapsed      time.Duration
+	// Exhaustive reports whether the search left out none of the pages it reached: none failed
+	// to fetch, was skipped because of robots.txt or had its backlink list truncated. The path
+	// found is then a shortest one, and no path means there is none within the depth. It says
+	// nothing of the pages past the path, as a search stops once it finds one
+	Exhaustive bool
+}
+
+// Found : Reports whether the search found a path
+func (r *SearchResult) Found() bool {
+	return r != nil && len(r.Hops) != 0
+}
+
+// Titles : Gets the titles of the pages on the path
+func (r *SearchResult) Titles() []string {
+	if !r.Found() {
+		return nil
+	}
+
+	titles := make([]string, 0, len(r.Hops))
+	for _, hop := range r.Hops {
+		titles = append(titles, hop.Title)
+	}
+
+	return titles
+}
+
+// searchStats : counters kept while a search runs
+type searchStats struct {
+	pagesFetched int
+	cacheHits    int
+	failedPages  int
+	skippedPages int
+	// truncatedLists counts the backlink lists a bidirectional search got only part of
+	truncatedLists int
+}
+
+// record : Counts a page fetched for the search
+func (s *searchStats) record(page crawledPage) {
+	switch {
+	case errors.Is(page.err, fetcher.ErrDisallowedByRobots):
+		s.skippedPages++
+	case page.err != nil:
+		s.failedPages++
+	case page.cached:
+		s.cacheHits++
+	default:
+		s.pagesFetched++
+	}
+}
+
+// edge : a link from one page to another
+type edge struct {
+	from string
+	to   string
+}
+
+// newSearchResult : Builds the result of a search from the URLs on the path found, if any. Hops
+// have the canonical URL of their page, not the URL of the link, which may be a redirect
+func newSearchResult(path []string, titles map[string]string, canonicals map[string]string,
+	anchors map[edge]parser.Link, depth int, stats searchStats, started time.Time) *SearchResult {
+
+	result := SearchResult{
+		Depth:        depth,
+		PagesFetched: stats.pagesFetched,
+		CacheHits:    stats.cacheHits,
+		FailedPages:  stats.failedPages,
+		SkippedPages: stats.skippedPages,
+		Elapsed:      time.Since(started),
+		Exhaustive:   stats.failedPages == 0 && stats.skippedPages == 0 && stats.truncatedLists == 0,
+	}
+
+	for index, url := range path {
+		hop := Hop{Title: titles[url], URL: url}
+		if canonical := canonicals[url]; canonical != "" {
+			hop.URL = canonical
+		}
+		if index > 0 {
+			link := anchors[edge{from: path[index-1], to: url}]
+			hop.AnchorText, hop.Section = link.Text, link.Section
+		}
+		result.Hops = append(result.Hops, hop)
+	}
+
+	if path != nil {
+		result.Depth = len(path) - 1
+	}
+
+	return &result
+}
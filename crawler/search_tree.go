@@ -0,0 +1,118 @@
+package crawler
+
+import (
+	"WikiGo/parser"
+	"sort"
+	"strings"
+)
+
+// searchTree : the parent DAG built by a BFS. Every node keeps all of its parents on the
+// previous level, so every shortest path to a node can be rebuilt from it
+type searchTree struct {
+	searchStats
+	parents    map[string][]string
+	titles     map[string]string
+	canonicals map[string]string
+	anchors    map[edge]parser.Link
+	targets    []string
+}
+
+func newSearchTree(src string) *searchTree {
+	return &searchTree{
+		parents:    map[string][]string{src: nil},
+		titles:     make(map[string]string),
+		canonicals: make(map[string]string),
+		anchors:    make(map[edge]parser.Link),
+	}
+}
+
+// addPage : Records the title and canonical URL of the page fetched for a node
+func (t *searchTree) addPage(page crawledPage) {
+	t.titles[page.url] = page.title
+	t.canonicals[page.url] = page.canonical
+}
+
+// addParent : Records the link from parent to node. A link that appears more than once on the
+// parent is recorded as it first appears
+func (t *searchTree) addParent(node string, parent string, link parser.Link) {
+	if _, exists := t.anchors[edge{from: parent, to: node}]; exists {
+		return
+	}
+
+	t.parents[node] = append(t.parents[node], parent)
+	t.anchors[edge{from: parent, to: node}] = link
+}
+
+// mergeParents : Records the parents of node as parents of into, for a node that turned out to be
+// another URL of the page at into
+func (t *searchTree) mergeParents(node string, into string) {
+	for _, parent := range t.parents[node] {
+		t.addParent(into, parent, t.anchors[edge{from: parent, to: node}])
+	}
+}
+
+// firstPath : Follows the first parent of each node back from the first target found and
+// returns the URLs along the way in source-to-destination order
+func (t *searchTree) firstPath() []string {
+	if len(t.targets) == 0 {
+		return nil
+	}
+
+	path := make([]string, 0)
+	for node := t.targets[0]; ; node = t.parents[node][0] {
+		path = append([]string{node}, path...)
+		if len(t.parents[node]) == 0 {
+			return path
+		}
+	}
+}
+
+// allPaths : Enumerates the distinct title paths from the source to every target, stopping
+// after maxPaths paths if it is positive. Parents are walked in title order and the result is
+// sorted, so the same DAG always gives the same paths
+func (t *searchTree) allPaths(maxPaths int) [][]string {
+	paths := make([][]string, 0)
+	seen := make(map[string]bool)
+
+	var walk func(node string, suffix []string)
+	walk = func(node string, suffix []string) {
+		if maxPaths > 0 && len(paths) >= maxPaths {
+			return
+		}
+
+		path := append([]string{t.titles[node]}, suffix...)
+		parents := t.parents[node]
+		if len(parents) == 0 {
+			key := strings.Join(path, "\x00")
+			if !seen[key] {
+				seen[key] = true
+				paths = append(paths, path)
+			}
+			return
+		}
+
+		for _, parent := range t.sortedByTitle(parents) {
+			walk(parent, path)
+		}
+	}
+
+	for _, target := range t.sortedByTitle(t.targets) {
+		walk(target, nil)
+	}
+
+	sort.Slice(paths, func(i, j int) bool {
+		return strings.Join(paths[i], "\x00") < strings.Join(paths[j], "\x00")
+	})
+	return paths
+}
+
+func (t *searchTree) sortedByTitle(nodes []string) []string {
+	sorted := append([]string(nil), nodes...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if t.titles[sorted[i]] != t.titles[sorted[j]] {
+			return t.titles[sorted[i]] < t.titles[sorted[j]]
+		}
+		return sorted[i] < sorted[j]
+	})
+	return sorted
+}
@@ -0,0 +1,52 @@
+package crawler
+
+import (
+	"WikiGo/wikipage"
+	"sync"
+)
+
+// visitedSet : the pages a search has reached, keyed by page key so that every URL of a page,
+// whatever its fragment, spelling or redirect, is visited once. Each page keeps the URL and
+// depth it was first reached at. It is safe for concurrent use
+type visitedSet struct {
+	mux   sync.Mutex
+	pages map[wikipage.PageKey]visit
+}
+
+// visit : where and when a page was first reached
+type visit struct {
+	url   string
+	depth int
+}
+
+func newVisitedSet() *visitedSet {
+	return &visitedSet{pages: make(map[wikipage.PageKey]visit)}
+}
+
+// add : Marks the page with the given key as reached through the URL at the given depth. If the
+// page had already been visited it returns false with the first visit
+func (v *visitedSet) add(key wikipage.PageKey, url string, depth int) (visit, bool) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	if first, visited := v.pages[key]; visited {
+		return first, false
+	}
+
+	v.pages[key] = visit{url: url, depth: depth}
+	return v.pages[key], true
+}
+
+// get : Gets the first visit of the page with the given key, if it has been visited
+func (v *visitedSet) get(key wikipage.PageKey) (visit, bool) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	first, visited := v.pages[key]
+	return first, visited
+}
+
+// addURL : Marks the page at the given URL as reached at the given depth, like add
+func (v *visitedSet) addURL(url string, depth int) (visit, bool) {
+	return v.add(wikipage.KeyFromURL(url), url, depth)
+}
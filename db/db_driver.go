@@ -1,45 +1,61 @@
 package db
 
 import (
+	"WikiGo/logging"
+	"context"
 	"database/sql"
-	"fmt"
-	"strconv"
+	"github.com/lib/pq"
 	"time"
 )
 
-// Driver : interface that has the basic operations for data store interaction
+// Driver : interface that has the basic operations for data store interaction. Pages are identified
+// by their wikipage.PageKey, stored in the title column of the pages table, with the human readable
+// title of crawled pages in the displayTitle column. The SQLDriver needs the tables of Schema, which
+// SQLDriver.Migrate creates, or adds the displayTitle column and redirects table to
 type Driver interface {
-	PageExists(pageTitle string) bool
-	RetrievePageID(pageTitle string) int
-	InsertPage(title string, url string, insertionTime time.Time) error
-	InsertPageTitleOnly(title string, insertionTime time.Time) error
-	UpdatePageAsCrawled(title string, url string, insertionTime time.Time) error
-	InsertEdge(sourceID int, destID int) error
-	RetrievePageLinks(pageTitle string) []string
-	RetrievePageURL(pageTitle string) string
-	RetrieveAllPageTitles() []string
-	RetrievePageInfo(title string) (string, bool, []string)
+	PageExists(ctx context.Context, pageTitle string) bool
+	RetrievePageID(ctx context.Context, pageTitle string) int
+	InsertPage(ctx context.Context, title string, url string, insertionTime time.Time) error
+	InsertPageTitleOnly(ctx context.Context, title string, insertionTime time.Time) error
+	InsertUncrawledPage(ctx context.Context, key string, url string, insertionTime time.Time) error
+	UpdatePageAsCrawled(ctx context.Context, key string, url string, displayTitle string, insertionTime time.Time) error
+	InsertEdge(ctx context.Context, sourceID int, destID int) error
+	RetrievePageLinks(ctx context.Context, pageTitle string) []string
+	RetrievePageBacklinks(ctx context.Context, pageTitle string) []string
+	RetrievePageURL(ctx context.Context, pageTitle string) string
+	RetrieveAllPageTitles(ctx context.Context) []string
+	RetrievePageInfo(ctx context.Context, key string) (string, string, bool, []string)
+	InsertRedirect(ctx context.Context, alias string, target string) error
+	RetrieveRedirectTarget(ctx context.Context, alias string) string
+	RetrieveRedirectAliases(ctx context.Context, target string) []string
 }
 
 // SQLDriver : A struct that operates on the SQL db directly
 type SQLDriver struct {
 	db       *sql.DB
 	numPages int
+	logger   logging.Logger
 }
 
 // NewSQLDriver : Creates a new SQLDriver object with the given db object
 func NewSQLDriver(db *sql.DB) *SQLDriver {
-	d := SQLDriver{db: db}
+	return NewSQLDriverWithLogger(db, logging.NewNopLogger())
+}
+
+// NewSQLDriverWithLogger : Creates a new SQLDriver object with the given db object that reports
+// failed queries to the given logger
+func NewSQLDriverWithLogger(db *sql.DB, logger logging.Logger) *SQLDriver {
+	d := SQLDriver{db: db, logger: logger}
 	d.numPages = 0
 	return &d
 }
 
 // PageExists : Queries all pages in the db and finds if the page with given title exists
-func (d *SQLDriver) PageExists(pageTitle string) bool {
-	rs, err := d.db.Query(`SELECT title FROM pages WHERE title=$1`, pageTitle)
+func (d *SQLDriver) PageExists(ctx context.Context, pageTitle string) bool {
+	rs, err := d.db.QueryContext(ctx, `SELECT title FROM pages WHERE title=$1`, pageTitle)
 
 	if err != nil {
-		fmt.Println(err)
+		d.logger.Error("db query failed", "op", "PageExists", "err", err)
 	}
 
 	if rs != nil {
@@ -58,8 +74,8 @@ func (d *SQLDriver) PageExists(pageTitle string) bool {
 }
 
 // InsertPage : Inserts a new page with given title and URL into the db
-func (d *SQLDriver) InsertPage(title string, url string, insertionTime time.Time) error {
-	_, err := d.db.Exec(
+func (d *SQLDriver) InsertPage(ctx context.Context, title string, url string, insertionTime time.Time) error {
+	_, err := d.db.ExecContext(ctx,
 		`INSERT INTO pages (title, url, isCrawled, lastCrawled)
 		VALUES ($1, $2, $3, $4)`, title, url, "t", insertionTime.String())
 	if err != nil {
@@ -70,12 +86,25 @@ func (d *SQLDriver) InsertPage(title string, url string, insertionTime time.Time
 }
 
 // InsertPageTitleOnly : Inserts a page with given title into the db
-func (d *SQLDriver) InsertPageTitleOnly(title string, insertionTime time.Time) error {
-	_, err := d.db.Exec(
+func (d *SQLDriver) InsertPageTitleOnly(ctx context.Context, title string, insertionTime time.Time) error {
+	_, err := d.db.ExecContext(ctx,
 		`INSERT INTO pages (title, url, isCrawled, lastCrawled)
 		VALUES ($1, $2, $3, $4)`, title, "", "f", insertionTime.String())
 	if err != nil {
-		fmt.Println(err)
+		d.logger.Error("db query failed", "op", "InsertPageTitleOnly", "err", err)
+		return err
+	}
+
+	return nil
+}
+
+// InsertUncrawledPage : Inserts a page that has been linked to but not crawled with the given key and URL
+func (d *SQLDriver) InsertUncrawledPage(ctx context.Context, key string, url string, insertionTime time.Time) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO pages (title, url, isCrawled, lastCrawled)
+		VALUES ($1, $2, $3, $4)`, key, url, "f", insertionTime.String())
+	if err != nil {
+		d.logger.Error("db query failed", "op", "InsertUncrawledPage", "err", err)
 		return err
 	}
 
@@ -83,8 +112,8 @@ func (d *SQLDriver) InsertPageTitleOnly(title string, insertionTime time.Time) e
 }
 
 // InsertEdge : Inserts a new edge relationship with given source and destination IDs into db
-func (d *SQLDriver) InsertEdge(srcID int, destID int) error {
-	_, err := d.db.Exec(
+func (d *SQLDriver) InsertEdge(ctx context.Context, srcID int, destID int) error {
+	_, err := d.db.ExecContext(ctx,
 		`INSERT INTO edges (srcID, destID)
 		VALUES ($1, $2)`, srcID, destID)
 	if err != nil {
@@ -94,14 +123,14 @@ func (d *SQLDriver) InsertEdge(srcID int, destID int) error {
 	return nil
 }
 
-// UpdatePageAsCrawled : Marks the page with the given title as crawled and adds its URL
-func (d *SQLDriver) UpdatePageAsCrawled(title string, url string, insertionTime time.Time) error {
+// UpdatePageAsCrawled : Marks the page with the given key as crawled and adds its URL and display title
+func (d *SQLDriver) UpdatePageAsCrawled(ctx context.Context, key string, url string, displayTitle string, insertionTime time.Time) error {
 	sqlStatement :=
 		`UPDATE pages
-	SET url = $1, isCrawled = 't'
-	WHERE title = $2;`
+	SET url = $1, displayTitle = $2, isCrawled = 't'
+	WHERE title = $3;`
 
-	_, err := d.db.Exec(sqlStatement, url, title)
+	_, err := d.db.ExecContext(ctx, sqlStatement, url, displayTitle, key)
 	if err != nil {
 		return err
 	}
@@ -109,11 +138,21 @@ func (d *SQLDriver) UpdatePageAsCrawled(title string, url string, insertionTime
 	return nil
 }
 
-// RetrievePageLinks : Retrieves all the titles of pages that are linked to the page with the given title
-func (d *SQLDriver) RetrievePageLinks(pageTitle string) []string {
-	rs, err := d.db.Query(`SELECT id, title, isCrawled FROM pages WHERE title=$1`, pageTitle)
+// RetrievePageLinks : Retrieves all the keys of pages that are linked to the page with the given key
+func (d *SQLDriver) RetrievePageLinks(ctx context.Context, pageTitle string) []string {
+	ids := d.retrieveLinkedIDs(ctx, pageTitle)
+	if ids == nil {
+		return nil
+	}
+
+	return d.retrieveColumnOfIDs(ctx, ids, "title")
+}
+
+// retrieveLinkedIDs : Retrieves the IDs of the pages linked to by the crawled page with the given key
+func (d *SQLDriver) retrieveLinkedIDs(ctx context.Context, key string) []int {
+	rs, err := d.db.QueryContext(ctx, `SELECT id, title, isCrawled FROM pages WHERE title=$1`, key)
 	if err != nil {
-		fmt.Println(err)
+		d.logger.Error("db query failed", "op", "retrieveLinkedIDs", "err", err)
 	}
 
 	if rs != nil {
@@ -125,7 +164,7 @@ func (d *SQLDriver) RetrievePageLinks(pageTitle string) []string {
 			rs.Scan(&id, &title, &isCrawled)
 
 			if isCrawled == "t" {
-				return d.retrieveTitlesOfIDs(d.retrieveEdges(id))
+				return d.retrieveEdges(ctx, id)
 			}
 		}
 	}
@@ -133,11 +172,93 @@ func (d *SQLDriver) RetrievePageLinks(pageTitle string) []string {
 	return nil
 }
 
+// RetrievePageBacklinks : Retrieves the URLs of all crawled pages that link to the page with the given title
+func (d *SQLDriver) RetrievePageBacklinks(ctx context.Context, pageTitle string) []string {
+	rs, err := d.db.QueryContext(ctx,
+		`SELECT src.url FROM pages src
+		JOIN edges ON edges.srcID = src.id
+		JOIN pages dest ON dest.id = edges.destID
+		WHERE dest.title = $1 AND src.isCrawled = 't'`, pageTitle)
+	if err != nil {
+		d.logger.Error("db query failed", "op", "RetrievePageBacklinks", "err", err)
+	}
+
+	urls := make([]string, 0)
+
+	if rs != nil {
+		defer rs.Close()
+		for rs.Next() {
+			var url string
+			rs.Scan(&url)
+
+			if url != "" {
+				urls = append(urls, url)
+			}
+		}
+	}
+
+	return urls
+}
+
+// InsertRedirect : Records that the page at the alias URL redirects to the page at the target URL,
+// replacing any target recorded before
+func (d *SQLDriver) InsertRedirect(ctx context.Context, alias string, target string) error {
+	_, err := d.db.ExecContext(ctx,
+		`INSERT INTO redirects (alias, target)
+		VALUES ($1, $2)
+		ON CONFLICT (alias) DO UPDATE SET target = $2`, alias, target)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RetrieveRedirectTarget : Gets the URL the page at the alias URL redirects to, or an empty string
+// if it isn't a known redirect
+func (d *SQLDriver) RetrieveRedirectTarget(ctx context.Context, alias string) string {
+	rs, err := d.db.QueryContext(ctx, `SELECT target FROM redirects WHERE alias=$1`, alias)
+	if err != nil {
+		d.logger.Error("db query failed", "op", "RetrieveRedirectTarget", "err", err)
+	}
+
+	if rs != nil {
+		defer rs.Close()
+		for rs.Next() {
+			var target string
+			rs.Scan(&target)
+			return target
+		}
+	}
+
+	return ""
+}
+
+// RetrieveRedirectAliases : Gets the URLs of the pages known to redirect to the page at the target URL
+func (d *SQLDriver) RetrieveRedirectAliases(ctx context.Context, target string) []string {
+	aliases := make([]string, 0)
+	rs, err := d.db.QueryContext(ctx, `SELECT alias FROM redirects WHERE target=$1`, target)
+	if err != nil {
+		d.logger.Error("db query failed", "op", "RetrieveRedirectAliases", "err", err)
+	}
+
+	if rs != nil {
+		defer rs.Close()
+		for rs.Next() {
+			var alias string
+			rs.Scan(&alias)
+			aliases = append(aliases, alias)
+		}
+	}
+
+	return aliases
+}
+
 // RetrievePageURL : Gets the URL of the page with the given title
-func (d *SQLDriver) RetrievePageURL(pageTitle string) string {
-	rs, err := d.db.Query(`SELECT title, isCrawled, url FROM pages WHERE title=$1`, pageTitle)
+func (d *SQLDriver) RetrievePageURL(ctx context.Context, pageTitle string) string {
+	rs, err := d.db.QueryContext(ctx, `SELECT title, isCrawled, url FROM pages WHERE title=$1`, pageTitle)
 	if err != nil {
-		fmt.Println(err)
+		d.logger.Error("db query failed", "op", "RetrievePageURL", "err", err)
 	}
 
 	if rs != nil {
@@ -158,10 +279,10 @@ func (d *SQLDriver) RetrievePageURL(pageTitle string) string {
 }
 
 // RetrieveAllPageTitles : Retrieves a list of all page titles in the db
-func (d *SQLDriver) RetrieveAllPageTitles() []string {
-	rs, err := d.db.Query("SELECT title FROM pages")
+func (d *SQLDriver) RetrieveAllPageTitles(ctx context.Context) []string {
+	rs, err := d.db.QueryContext(ctx, "SELECT title FROM pages")
 	if err != nil {
-		fmt.Println(err)
+		d.logger.Error("db query failed", "op", "RetrieveAllPageTitles", "err", err)
 	}
 
 	titles := make([]string, 0)
@@ -180,10 +301,10 @@ func (d *SQLDriver) RetrieveAllPageTitles() []string {
 }
 
 // RetrievePageID : Retrieves the ID of the page with the given title
-func (d *SQLDriver) RetrievePageID(pageTitle string) int {
-	rs, err := d.db.Query(`SELECT id FROM pages WHERE title=$1`, pageTitle)
+func (d *SQLDriver) RetrievePageID(ctx context.Context, pageTitle string) int {
+	rs, err := d.db.QueryContext(ctx, `SELECT id FROM pages WHERE title=$1`, pageTitle)
 	if err != nil {
-		fmt.Println(err)
+		d.logger.Error("db query failed", "op", "RetrievePageID", "err", err)
 	}
 
 	if rs != nil {
@@ -199,14 +320,16 @@ func (d *SQLDriver) RetrievePageID(pageTitle string) int {
 	return -1
 }
 
-// RetrievePageInfo : Retrieves all page info for a page given its title
-func (d *SQLDriver) RetrievePageInfo(title string) (string, bool, []string) {
-	rs, err := d.db.Query(`SELECT url, isCrawled FROM pages WHERE title=$1`, title)
+// RetrievePageInfo : Retrieves the URL, display title, crawled status and the URLs of the links
+// of a page given its key
+func (d *SQLDriver) RetrievePageInfo(ctx context.Context, key string) (string, string, bool, []string) {
+	rs, err := d.db.QueryContext(ctx, `SELECT url, displayTitle, isCrawled FROM pages WHERE title=$1`, key)
 	if err != nil {
-		fmt.Println(err)
+		d.logger.Error("db query failed", "op", "RetrievePageInfo", "err", err)
 	}
 
 	var url string
+	var displayTitle sql.NullString
 	var isCrawled bool
 	var links []string
 
@@ -214,7 +337,7 @@ func (d *SQLDriver) RetrievePageInfo(title string) (string, bool, []string) {
 		defer rs.Close()
 		for rs.Next() {
 			var isCrawledString string
-			rs.Scan(&url, &isCrawledString)
+			rs.Scan(&url, &displayTitle, &isCrawledString)
 
 			if isCrawledString == "t" {
 				isCrawled = true
@@ -225,16 +348,19 @@ func (d *SQLDriver) RetrievePageInfo(title string) (string, bool, []string) {
 		}
 	}
 
-	links = d.RetrievePageLinks(title)
+	if ids := d.retrieveLinkedIDs(ctx, key); ids != nil {
+		links = d.retrieveColumnOfIDs(ctx, ids, "url")
+	}
 
-	return url, isCrawled, links
+	return url, displayTitle.String, isCrawled, links
 }
 
-func (d *SQLDriver) retrieveEdges(srcID int) []int {
-	rs, err := d.db.Query(`SELECT * FROM edges WHERE src=$1`, srcID)
+// retrieveEdges : Retrieves the IDs of the pages the page with the given ID links to
+func (d *SQLDriver) retrieveEdges(ctx context.Context, srcID int) []int {
+	rs, err := d.db.QueryContext(ctx, `SELECT srcID, destID FROM edges WHERE srcID=$1`, srcID)
 
 	if err != nil {
-		fmt.Println(err)
+		d.logger.Error("db query failed", "op", "retrieveEdges", "err", err)
 	}
 	destIDs := make([]int, 0)
 
@@ -254,31 +380,33 @@ func (d *SQLDriver) retrieveEdges(srcID int) []int {
 	return destIDs
 }
 
-func (d *SQLDriver) retrieveTitlesOfIDs(ids []int) []string {
-	idListString := ""
-	for index, id := range ids {
-		idListString += strconv.Itoa(id)
-		if index < len(ids) {
-			idListString += ","
-		}
+// retrieveColumnOfIDs : Retrieves the given column, title or url, of the pages with the given IDs
+func (d *SQLDriver) retrieveColumnOfIDs(ctx context.Context, ids []int, column string) []string {
+	values := make([]string, 0)
+	if len(ids) == 0 {
+		return values
 	}
-	rs, err := d.db.Query("SELECT id, title FROM pages WHERE id in ($1)", idListString)
-	if err != nil {
-		fmt.Println(err)
+
+	idArray := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		idArray = append(idArray, int64(id))
 	}
 
-	titles := make([]string, 0)
+	rs, err := d.db.QueryContext(ctx, "SELECT id, "+column+" FROM pages WHERE id = ANY($1)", pq.Array(idArray))
+	if err != nil {
+		d.logger.Error("db query failed", "op", "retrieveColumnOfIDs", "err", err)
+	}
 
 	if rs != nil {
 		defer rs.Close()
 		for rs.Next() {
 			var id int
-			var title string
-			rs.Scan(&id, &title)
+			var value string
+			rs.Scan(&id, &value)
 
-			titles = append(titles, title)
+			values = append(values, value)
 		}
 	}
 
-	return titles
+	return values
 }
@@ -1,62 +1,75 @@
 package db
 
 import (
+	"WikiGo/logging"
 	"WikiGo/wikipage"
-	"fmt"
+	"context"
 	"time"
 )
 
 // Service : Service wrapper that contains functionality for reading/writing cached wiki pages and their links
 type Service struct {
 	driver Driver
+	logger logging.Logger
 }
 
 // NewDBService : Creates a new DB service with a driver injected
 func NewDBService(driver Driver) *Service {
-	return &Service{driver}
+	return NewDBServiceWithLogger(driver, logging.NewNopLogger())
 }
 
-// AddPage : Adds a wikipage entry to the database
-func (s *Service) AddPage(page *wikipage.WikiPage) error {
+// NewDBServiceWithLogger : Creates a new DB service with a driver and a logger injected
+func NewDBServiceWithLogger(driver Driver, logger logging.Logger) *Service {
+	return &Service{driver: driver, logger: logger}
+}
+
+// AddPage : Adds a wikipage entry to the database, keyed by its key. The links of the page are
+// URLs, and the pages they lead to are keyed by wikipage.KeyFromURL
+func (s *Service) AddPage(ctx context.Context, page *wikipage.WikiPage) error {
 	var err error
-	title := page.GetTitle()
+	key := string(page.GetKey())
 	currentTime := time.Now()
 
-	if !s.driver.PageExists(title) {
-		err = s.driver.InsertPageTitleOnly(title, currentTime)
+	if !s.driver.PageExists(ctx, key) {
+		err = s.driver.InsertPageTitleOnly(ctx, key, currentTime)
 		if err != nil {
-			fmt.Println(err)
+			s.logger.Error("inserting page failed", "key", key, "err", err)
 			return err
 		}
 	}
 
-	srcID := s.driver.RetrievePageID(title)
+	srcID := s.driver.RetrievePageID(ctx, key)
 	for _, link := range page.GetLinks() {
-		if !s.driver.PageExists(link) {
-			err = s.driver.InsertPageTitleOnly(link, currentTime)
+		linkKey := string(wikipage.KeyFromURL(link))
+		if !s.driver.PageExists(ctx, linkKey) {
+			err = s.driver.InsertUncrawledPage(ctx, linkKey, link, currentTime)
 			if err != nil {
 				return err
 			}
 		}
-		destID := s.driver.RetrievePageID(link)
-		err = s.driver.InsertEdge(srcID, destID)
+		destID := s.driver.RetrievePageID(ctx, linkKey)
+		err = s.driver.InsertEdge(ctx, srcID, destID)
 		if err != nil {
 			return err
 		}
 	}
 
-	s.driver.UpdatePageAsCrawled(title, page.GetURL(), currentTime)
+	err = s.driver.UpdatePageAsCrawled(ctx, key, page.GetURL(), page.GetTitle(), currentTime)
+	if err != nil {
+		s.logger.Error("marking page as crawled failed", "key", key, "err", err)
+		return err
+	}
 
 	return nil
 }
 
-// GetPageGraph : Returns an adjacency list of a graph of wiki articles that have links to each other
-func (s *Service) GetPageGraph() map[string][]string {
-	titles := s.driver.RetrieveAllPageTitles()
+// GetPageGraph : Returns an adjacency list of a graph of the keys of wiki articles that have links to each other
+func (s *Service) GetPageGraph(ctx context.Context) map[string][]string {
+	titles := s.driver.RetrieveAllPageTitles(ctx)
 	graph := make(map[string][]string)
 
 	for _, title := range titles {
-		links := s.driver.RetrievePageLinks(title)
+		links := s.driver.RetrievePageLinks(ctx, title)
 		if links != nil {
 			graph[title] = links
 		}
@@ -65,26 +78,56 @@ func (s *Service) GetPageGraph() map[string][]string {
 	return graph
 }
 
-// GetURLs : Returns a map of page titles and their URLs
-func (s *Service) GetURLs() map[string]string {
-	titles := s.driver.RetrieveAllPageTitles()
-	urlMap := make(map[string]string)
+// GetBacklinks : Returns the URLs of the crawled pages that link to the page with the given key
+func (s *Service) GetBacklinks(ctx context.Context, key wikipage.PageKey) []string {
+	return s.driver.RetrievePageBacklinks(ctx, string(key))
+}
+
+// GetURLs : Returns a map of the keys of crawled pages and their URLs
+func (s *Service) GetURLs(ctx context.Context) map[wikipage.PageKey]string {
+	keys := s.driver.RetrieveAllPageTitles(ctx)
+	urlMap := make(map[wikipage.PageKey]string)
 
-	for _, title := range titles {
-		url := s.driver.RetrievePageURL(title)
+	for _, key := range keys {
+		url := s.driver.RetrievePageURL(ctx, key)
 		if url != "" {
-			urlMap[title] = url
+			urlMap[wikipage.PageKey(key)] = url
 		}
 	}
 
 	return urlMap
 }
 
-// GetPage : Returns a wikipage object of a page title if it exists in the db
-func (s *Service) GetPage(title string) *wikipage.WikiPage {
-	if s.driver.PageExists(title) {
-		url, isCrawled, links := s.driver.RetrievePageInfo(title)
-		return wikipage.NewWikiPageWithCrawlStatus(url, title, links, isCrawled)
+// AddRedirect : Records that the page at the alias URL is a redirect to the page at the target URL
+func (s *Service) AddRedirect(ctx context.Context, alias string, target string) error {
+	err := s.driver.InsertRedirect(ctx, alias, target)
+	if err != nil {
+		s.logger.Error("inserting redirect failed", "alias", alias, "target", target, "err", err)
+	}
+
+	return err
+}
+
+// GetRedirect : Returns the URL the page at the alias URL redirects to, or the alias itself if it
+// isn't a known redirect
+func (s *Service) GetRedirect(ctx context.Context, alias string) string {
+	if target := s.driver.RetrieveRedirectTarget(ctx, alias); target != "" {
+		return target
+	}
+
+	return alias
+}
+
+// GetRedirectAliases : Returns the URLs of the pages known to redirect to the page at the target URL
+func (s *Service) GetRedirectAliases(ctx context.Context, target string) []string {
+	return s.driver.RetrieveRedirectAliases(ctx, target)
+}
+
+// GetPage : Returns a wikipage object of a page key if it exists in the db, with the URLs of its links
+func (s *Service) GetPage(ctx context.Context, key wikipage.PageKey) *wikipage.WikiPage {
+	if s.driver.PageExists(ctx, string(key)) {
+		url, displayTitle, isCrawled, links := s.driver.RetrievePageInfo(ctx, string(key))
+		return wikipage.NewWikiPageWithKey(key, url, displayTitle, links, isCrawled)
 	}
 
 	return nil
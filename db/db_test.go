@@ -2,11 +2,14 @@ package db
 
 import (
 	"WikiGo/wikipage"
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 )
 
 func assertSameWikiPage(t *testing.T, expected *wikipage.WikiPage, result *wikipage.WikiPage) {
@@ -32,7 +35,7 @@ type TestPage struct {
 func TestInsertPage(t *testing.T) {
 	t.Run("Test inserting one page", func(t *testing.T) {
 		testObject := TestPage{title: "Example Page", url: "www.example.com", isCrawled: "t"}
-		testLink := TestPage{title: "Example 1", url: "", isCrawled: "f"}
+		testLink := TestPage{title: "Example_1", url: "www.example.com/wiki/Example_1", isCrawled: "f"}
 
 		db, mock, err := sqlmock.New()
 		if err != nil {
@@ -61,7 +64,8 @@ func TestInsertPage(t *testing.T) {
 		mock.ExpectQuery(`SELECT`).WithArgs(testObject.title).WillReturnRows(
 			sqlmock.NewRows([]string{"id", "title", "isCrawled"}).
 				AddRow(0, testObject.title, testObject.isCrawled))
-		mock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{"srcID", "destID"}).AddRow(0, 1))
+		mock.ExpectQuery(`SELECT srcID, destID FROM edges WHERE srcID`).WithArgs(0).WillReturnRows(
+			sqlmock.NewRows([]string{"srcID", "destID"}).AddRow(0, 1))
 		mock.ExpectQuery(`SELECT`).WillReturnRows(
 			sqlmock.NewRows([]string{"id", "title"}).
 				AddRow(1, testLink.title))
@@ -72,11 +76,11 @@ func TestInsertPage(t *testing.T) {
 
 		testDriver := NewSQLDriver(db)
 		testDBService := NewDBService(testDriver)
-		testPage := wikipage.NewWikiPage(testObject.url, testObject.title, []string{"Example 1"})
-		testDBService.AddPage(testPage)
+		testPage := wikipage.NewWikiPage(testObject.url, testObject.title, []string{testLink.url})
+		testDBService.AddPage(context.Background(), testPage)
 
-		expected := map[string][]string{testObject.title: []string{"Example 1"}}
-		result := testDBService.GetPageGraph()
+		expected := map[string][]string{testObject.title: []string{testLink.title}}
+		result := testDBService.GetPageGraph(context.Background())
 
 		if !reflect.DeepEqual(expected, result) {
 			t.Errorf("Expected '%q' but got '%q'", expected, result)
@@ -86,7 +90,7 @@ func TestInsertPage(t *testing.T) {
 
 func TestGetPage(t *testing.T) {
 	testObject := TestPage{title: "Example Page", url: "www.example.com", isCrawled: "t"}
-	testLink := TestPage{title: "Example 1", url: "", isCrawled: "f"}
+	testLink := TestPage{title: "Example_1", url: "www.example.com/wiki/Example_1", isCrawled: "f"}
 
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -106,23 +110,168 @@ func TestGetPage(t *testing.T) {
 		sqlmock.NewRows([]string{"id"}).
 			AddRow(1))
 	mock.ExpectExec("INSERT INTO edges").WithArgs(0, 1).WillReturnResult(sqlmock.NewResult(1, 1))
-	mock.ExpectExec("UPDATE pages").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE pages").WithArgs(testObject.url, testObject.title, testObject.title).WillReturnResult(sqlmock.NewResult(1, 1))
 
 	testDriver := NewSQLDriver(db)
 	testDBService := NewDBService(testDriver)
-	testPage := wikipage.NewWikiPageWithCrawlStatus(testObject.url, testObject.title, []string{"Example 1"}, true)
-	testDBService.AddPage(testPage)
+	testPage := wikipage.NewWikiPageWithCrawlStatus(testObject.url, testObject.title, []string{testLink.url}, true)
+	testDBService.AddPage(context.Background(), testPage)
 
-	mock.ExpectQuery(`SELECT`).WithArgs(testObject.title).WillReturnRows(sqlmock.NewRows([]string{"url", "isCrawled"}).
-		AddRow(testObject.url, testObject.isCrawled))
+	mock.ExpectQuery(`SELECT`).WithArgs(testObject.title).WillReturnRows(
+		sqlmock.NewRows([]string{"title"}).
+			AddRow(testObject.title))
+	mock.ExpectQuery(`SELECT url, displayTitle, isCrawled`).WithArgs(testObject.title).WillReturnRows(sqlmock.NewRows([]string{"url", "displayTitle", "isCrawled"}).
+		AddRow(testObject.url, testObject.title, testObject.isCrawled))
 	mock.ExpectQuery(`SELECT`).WithArgs(testObject.title).WillReturnRows(
 		sqlmock.NewRows([]string{"id", "title", "isCrawled"}).
 			AddRow(0, testObject.title, testObject.isCrawled))
-	mock.ExpectQuery(`SELECT`).WillReturnRows(sqlmock.NewRows([]string{"srcID", "destID"}).AddRow(0, 1))
-	mock.ExpectQuery(`SELECT`).WillReturnRows(
-		sqlmock.NewRows([]string{"id", "title"}).
-			AddRow(1, testLink.title))
+	mock.ExpectQuery(`SELECT srcID, destID FROM edges WHERE srcID`).WithArgs(0).WillReturnRows(
+		sqlmock.NewRows([]string{"srcID", "destID"}).AddRow(0, 1))
+	mock.ExpectQuery(`SELECT id, url FROM pages WHERE id = ANY`).WithArgs(pq.Array([]int64{1})).WillReturnRows(
+		sqlmock.NewRows([]string{"id", "url"}).
+			AddRow(1, testLink.url))
 
-	resultPage := testDBService.GetPage(testObject.title)
+	resultPage := testDBService.GetPage(context.Background(), wikipage.PageKey(testObject.title))
 	assertSameWikiPage(t, testPage, resultPage)
+	if resultPage.GetKey() != testPage.GetKey() {
+		t.Errorf("Expected key '%q' but got '%q'", testPage.GetKey(), resultPage.GetKey())
+	}
+}
+
+func TestGetBacklinks(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		fmt.Println("failed to open sqlmock database:", err)
+	}
+	defer db.Close()
+
+	mock.ExpectQuery(`SELECT src.url FROM pages src`).WithArgs("www.example.com/1").WillReturnRows(
+		sqlmock.NewRows([]string{"url"}).
+			AddRow("www.example.com").
+			AddRow("www.example.com/2"))
+
+	testDBService := NewDBService(NewSQLDriver(db))
+
+	expected := []string{"www.example.com", "www.example.com/2"}
+	result := testDBService.GetBacklinks(context.Background(), "www.example.com/1")
+
+	if !reflect.DeepEqual(expected, result) {
+		t.Errorf("Expected '%q' but got '%q'", expected, result)
+	}
+}
+
+func TestRedirects(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		fmt.Println("failed to open sqlmock database:", err)
+	}
+	defer db.Close()
+
+	mock.ExpectExec("INSERT INTO redirects").WithArgs("www.example.com/wiki/UK", "www.example.com/wiki/United_Kingdom").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectQuery(`SELECT target FROM redirects`).WithArgs("www.example.com/wiki/UK").WillReturnRows(
+		sqlmock.NewRows([]string{"target"}).
+			AddRow("www.example.com/wiki/United_Kingdom"))
+	mock.ExpectQuery(`SELECT target FROM redirects`).WithArgs("www.example.com/wiki/Fife").WillReturnRows(
+		sqlmock.NewRows([]string{"target"}))
+	mock.ExpectQuery(`SELECT alias FROM redirects WHERE target`).WithArgs("www.example.com/wiki/United_Kingdom").
+		WillReturnRows(sqlmock.NewRows([]string{"alias"}).AddRow("www.example.com/wiki/UK"))
+
+	testDBService := NewDBService(NewSQLDriver(db))
+
+	t.Run("Add a redirect", func(t *testing.T) {
+		if err := testDBService.AddRedirect(context.Background(), "www.example.com/wiki/UK", "www.example.com/wiki/United_Kingdom"); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Follow a known redirect", func(t *testing.T) {
+		expected := "www.example.com/wiki/United_Kingdom"
+		if result := testDBService.GetRedirect(context.Background(), "www.example.com/wiki/UK"); result != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("Pages that aren't redirects are their own target", func(t *testing.T) {
+		expected := "www.example.com/wiki/Fife"
+		if result := testDBService.GetRedirect(context.Background(), expected); result != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("List the aliases of a target", func(t *testing.T) {
+		expected := []string{"www.example.com/wiki/UK"}
+		result := testDBService.GetRedirectAliases(context.Background(), "www.example.com/wiki/United_Kingdom")
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	t.Run("Create the tables and columns", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS pages").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("ALTER TABLE pages ADD COLUMN IF NOT EXISTS displayTitle").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS edges").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS redirects").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if err := NewSQLDriver(db).Migrate(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("Stop at the first failure", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS pages").WillReturnError(errors.New("permission denied"))
+
+		if err := NewSQLDriver(db).Migrate(context.Background()); err == nil {
+			t.Error("Expected the migration to fail")
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestAddPageNotMarkedCrawled(t *testing.T) {
+	t.Run("Report a failed update", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery(`SELECT`).WithArgs("Example Page").WillReturnRows(sqlmock.NewRows([]string{"title"}).AddRow("Example Page"))
+		mock.ExpectQuery(`SELECT`).WithArgs("Example Page").WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0))
+		mock.ExpectExec("UPDATE pages").WillReturnError(errors.New(`column "displaytitle" does not exist`))
+
+		page := wikipage.NewWikiPageWithCrawlStatus("www.example.com", "Example Page", nil, true)
+		if err := NewDBService(NewSQLDriver(db)).AddPage(context.Background(), page); err == nil {
+			t.Error("Expected the failed update to be returned")
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
 }
@@ -0,0 +1,43 @@
+package db
+
+import "context"
+
+// Schema : the statements that create the tables the SQLDriver reads and writes, and add the
+// columns later versions need to tables created by earlier ones. Every statement can be run
+// again, so they can be run on every start:
+//
+//	pages     (id, title, url, isCrawled, lastCrawled, displayTitle), keyed by the unique title
+//	          column, which holds the wikipage.PageKey of the page
+//	edges     (srcID, destID), the links between pages
+//	redirects (alias, target), keyed by the unique alias column that InsertRedirect upserts on
+var Schema = []string{
+	`CREATE TABLE IF NOT EXISTS pages (
+		id SERIAL PRIMARY KEY,
+		title TEXT NOT NULL UNIQUE,
+		url TEXT NOT NULL DEFAULT '',
+		isCrawled TEXT NOT NULL DEFAULT 'f',
+		lastCrawled TEXT
+	)`,
+	`ALTER TABLE pages ADD COLUMN IF NOT EXISTS displayTitle TEXT`,
+	`CREATE TABLE IF NOT EXISTS edges (
+		srcID INTEGER NOT NULL REFERENCES pages (id),
+		destID INTEGER NOT NULL REFERENCES pages (id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS redirects (
+		alias TEXT PRIMARY KEY,
+		target TEXT NOT NULL
+	)`,
+}
+
+// Migrate : Runs the Schema statements, creating the tables the driver needs or bringing tables
+// created by earlier versions up to date
+func (d *SQLDriver) Migrate(ctx context.Context) error {
+	for _, statement := range Schema {
+		if _, err := d.db.ExecContext(ctx, statement); err != nil {
+			d.logger.Error("db migration failed", "op", "Migrate", "err", err)
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,304 @@
+package fetcher
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CachePolicy : how long a CacheTransport serves responses without revalidating them, and how
+// much disk space it may use
+type CachePolicy struct {
+	// TTL : how long a stored response is served without asking the server. Zero uses the
+	// max-age of the response's Cache-Control header, revalidating every time if there is none
+	TTL time.Duration
+	// MaxBytes : size of the cache above which the least recently used responses are evicted.
+	// Zero means no limit
+	MaxBytes int64
+	// MaxBodySize : largest body, once decoded, that is read and stored. Larger responses fail with
+	// a BodyTooLargeError and aren't stored. Zero means no limit
+	MaxBodySize int64
+}
+
+// CacheTransport : http.RoundTripper that keeps successful GET responses on disk and revalidates stale ones
+type CacheTransport struct {
+	dir     string
+	next    http.RoundTripper
+	policy  CachePolicy
+	mux     sync.Mutex
+	entries map[string]cacheUsage
+	size    int64
+}
+
+// cacheEntry : a response stored on disk
+type cacheEntry struct {
+	URL          string      `json:"url"`
+	Header       http.Header `json:"header"`
+	Body         []byte      `json:"body"`
+	ETag         string      `json:"etag,omitempty"`
+	LastModified string      `json:"lastModified,omitempty"`
+	StoredAt     time.Time   `json:"storedAt"`
+	MaxAge       int64       `json:"maxAge"`
+}
+
+// cacheUsage : the size of a stored response and when it was last used, for eviction
+type cacheUsage struct {
+	size int64
+	used time.Time
+}
+
+// NewCacheTransport : Creates a cache transport storing responses in dir, created if needed, in front of next
+func NewCacheTransport(dir string, next http.RoundTripper, policy CachePolicy) (*CacheTransport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &CacheTransport{dir: dir, next: next, policy: policy, entries: make(map[string]cacheUsage)}
+	for _, file := range files {
+		if key := strings.TrimSuffix(file.Name(), ".json"); key != file.Name() && !file.IsDir() {
+			t.entries[key] = cacheUsage{size: file.Size(), used: file.ModTime()}
+			t.size += file.Size()
+		}
+	}
+
+	return t, nil
+}
+
+// RoundTrip : Serves a GET request from the cache if the stored response is fresh, otherwise
+// sends it, conditionally if a response is stored, and stores a successful response
+func (t *CacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	key := cacheKey(req.URL.String())
+	entry := t.load(key)
+	if entry != nil && entry.fresh(time.Now(), t.policy.TTL) {
+		t.touch(key)
+		return entry.response(req), nil
+	}
+
+	sent := req
+	if entry != nil && (entry.ETag != "" || entry.LastModified != "") {
+		sent = req.Clone(req.Context())
+		if entry.ETag != "" {
+			sent.Header.Set("If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			sent.Header.Set("If-Modified-Since", entry.LastModified)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(sent)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && entry != nil && sent != req {
+		resp.Body.Close()
+		entry.StoredAt = time.Now()
+		if resp.Header.Get("Cache-Control") != "" {
+			entry.MaxAge = maxAge(resp.Header)
+		}
+		t.store(key, entry)
+		return entry.response(req), nil
+	}
+
+	if resp.StatusCode != http.StatusOK || strings.Contains(resp.Header.Get("Cache-Control"), "no-store") {
+		return resp, nil
+	}
+
+	body, err := t.readBody(req, resp)
+	if err != nil {
+		return nil, err
+	}
+
+	t.store(key, &cacheEntry{
+		URL:          req.URL.String(),
+		Header:       resp.Header,
+		Body:         body,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		StoredAt:     time.Now(),
+		MaxAge:       maxAge(resp.Header),
+	})
+
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// readBody : Reads and closes the body of a response, failing as soon as it exceeds the max body size
+func (t *CacheTransport) readBody(req *http.Request, resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	limit := t.policy.MaxBodySize
+	if limit <= 0 {
+		return ioutil.ReadAll(resp.Body)
+	}
+
+	if resp.ContentLength > limit {
+		return nil, &BodyTooLargeError{URL: req.URL.String(), Limit: limit}
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(body)) > limit {
+		return nil, &BodyTooLargeError{URL: req.URL.String(), Limit: limit}
+	}
+
+	return body, nil
+}
+
+// load : Reads the response stored under the given key, if any
+func (t *CacheTransport) load(key string) *cacheEntry {
+	data, err := ioutil.ReadFile(t.path(key))
+	if err != nil {
+		return nil
+	}
+
+	var entry cacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil
+	}
+
+	return &entry
+}
+
+// store : Writes a response under the given key and evicts the least recently used responses
+// until the cache fits its size limit. Failing to write only means the response isn't cached
+func (t *CacheTransport) store(key string, entry *cacheEntry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	temp := t.path(key) + ".tmp"
+	if err := ioutil.WriteFile(temp, data, 0644); err != nil {
+		return
+	}
+
+	if err := os.Rename(temp, t.path(key)); err != nil {
+		os.Remove(temp)
+		return
+	}
+
+	t.size += int64(len(data)) - t.entries[key].size
+	t.entries[key] = cacheUsage{size: int64(len(data)), used: time.Now()}
+	t.evict()
+}
+
+// touch : Marks the response stored under the given key as just used
+func (t *CacheTransport) touch(key string) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+
+	now := time.Now()
+	if usage, exists := t.entries[key]; exists {
+		usage.used = now
+		t.entries[key] = usage
+		os.Chtimes(t.path(key), now, now)
+	}
+}
+
+// evict : Removes the least recently used responses until the cache fits its size limit
+func (t *CacheTransport) evict() {
+	if t.policy.MaxBytes <= 0 || t.size <= t.policy.MaxBytes {
+		return
+	}
+
+	keys := make([]string, 0, len(t.entries))
+	for key := range t.entries {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return t.entries[keys[i]].used.Before(t.entries[keys[j]].used) })
+
+	for _, key := range keys {
+		if t.size <= t.policy.MaxBytes {
+			return
+		}
+
+		if err := os.Remove(t.path(key)); err != nil && !os.IsNotExist(err) {
+			continue
+		}
+		t.size -= t.entries[key].size
+		delete(t.entries, key)
+	}
+}
+
+func (t *CacheTransport) path(key string) string {
+	return filepath.Join(t.dir, key+".json")
+}
+
+// fresh : Reports whether the response can be served without asking the server
+func (e *cacheEntry) fresh(now time.Time, ttl time.Duration) bool {
+	if ttl <= 0 {
+		ttl = time.Duration(e.MaxAge) * time.Second
+	}
+
+	return now.Sub(e.StoredAt) < ttl
+}
+
+// response : Builds the response to the given request from the stored one
+func (e *cacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// maxAge : Gets the max-age of a response's Cache-Control header in seconds, or zero if it has
+// none or must not be served without revalidating
+func maxAge(header http.Header) int64 {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if directive == "no-cache" {
+			return 0
+		}
+
+		if value := strings.TrimPrefix(directive, "max-age="); value != directive {
+			if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds > 0 {
+				return seconds
+			}
+		}
+	}
+
+	return 0
+}
+
+// cacheKey : Gets the name a response is stored under from its URL
+func cacheKey(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,111 @@
+package fetcher
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// Decoder : decodes a response body sent with a Content-Encoding
+type Decoder func(body io.Reader) (io.ReadCloser, error)
+
+// DefaultDecoders : Gets the decoders of the encodings the standard library can decode, gzip and deflate
+func DefaultDecoders() map[string]Decoder {
+	return map[string]Decoder{
+		"gzip": func(body io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(body)
+		},
+		"deflate": func(body io.Reader) (io.ReadCloser, error) {
+			return zlib.NewReader(body)
+		},
+	}
+}
+
+// DecompressTransport : http.RoundTripper that asks for compressed responses in every encoding it
+// has a decoder for, and decodes them so that callers only ever see the original body
+type DecompressTransport struct {
+	next           http.RoundTripper
+	decoders       map[string]Decoder
+	acceptEncoding string
+}
+
+// decodedBody : the body of a decoded response, closing both the decoder and the raw body
+type decodedBody struct {
+	io.ReadCloser
+	raw io.Closer
+}
+
+// NewDecompressTransport : Creates a decompress transport in front of next, with DefaultDecoders if nil
+func NewDecompressTransport(next http.RoundTripper, decoders map[string]Decoder) *DecompressTransport {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+
+	if decoders == nil {
+		decoders = DefaultDecoders()
+	}
+
+	encodings := make([]string, 0, len(decoders))
+	for encoding := range decoders {
+		encodings = append(encodings, encoding)
+	}
+	sort.Strings(encodings)
+
+	return &DecompressTransport{next: next, decoders: decoders, acceptEncoding: strings.Join(encodings, ", ")}
+}
+
+// RoundTrip : Sends the request accepting every encoding with a decoder, and decodes the
+// response. Requests that already name the encodings they accept are passed through untouched
+func (t *DecompressTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") != "" || req.Method == http.MethodHead || t.acceptEncoding == "" {
+		return t.next.RoundTrip(req)
+	}
+
+	sent := req.Clone(req.Context())
+	sent.Header.Set("Accept-Encoding", t.acceptEncoding)
+
+	resp, err := t.next.RoundTrip(sent)
+	if err != nil {
+		return nil, err
+	}
+
+	resp.Request = req
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" || resp.StatusCode == http.StatusNotModified ||
+		resp.StatusCode == http.StatusNoContent {
+		return resp, nil
+	}
+
+	decoder, exists := t.decoders[encoding]
+	if !exists {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: unsupported content encoding %q", req.URL, encoding)
+	}
+
+	body, err := decoder(resp.Body)
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: decoding %s body: %w", req.URL, encoding, err)
+	}
+
+	resp.Body = &decodedBody{ReadCloser: body, raw: resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return resp, nil
+}
+
+// Close : Closes the decoder and the raw body
+func (b *decodedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if rawErr := b.raw.Close(); err == nil {
+		err = rawErr
+	}
+
+	return err
+}
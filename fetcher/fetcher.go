@@ -0,0 +1,310 @@
+package fetcher
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrNotFound : returned by fetchers that have no page for the requested URL
+var ErrNotFound = errors.New("page not found")
+
+// StatusError : returned by HTTPFetcher when the server answers with a status other than 2xx.
+// RetryAfter is the delay given in the Retry-After header, or zero if there was none
+type StatusError struct {
+	URL        string
+	Code       int
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.URL, e.Code, http.StatusText(e.Code))
+}
+
+// Is : Reports whether the target is ErrNotFound and the page is missing or gone
+func (e *StatusError) Is(target error) bool {
+	return target == ErrNotFound && (e.Code == http.StatusNotFound || e.Code == http.StatusGone)
+}
+
+// BodyTooLargeError : returned by HTTPFetcher when a response body, once decoded, is larger than
+// the max body size of the fetcher
+type BodyTooLargeError struct {
+	URL   string
+	Limit int64
+}
+
+func (e *BodyTooLargeError) Error() string {
+	return fmt.Sprintf("%s: body larger than %d bytes", e.URL, e.Limit)
+}
+
+// Fetcher : interface for retrieving the body of a page. The final URL is the URL the body was
+// actually served from, which differs from the requested one when redirects were followed
+type Fetcher interface {
+	Fetch(ctx context.Context, url string) ([]byte, string, error)
+}
+
+// StreamFetcher : Fetcher that can also hand over the body of a page while it is downloaded
+type StreamFetcher interface {
+	Fetcher
+	FetchStream(ctx context.Context, url string) (io.ReadCloser, string, error)
+}
+
+// Stream : Gets the body of the page at the given URL as a stream, which the caller closes. The
+// body is streamed if the fetcher is a StreamFetcher, otherwise it is read whole by Fetch
+func Stream(ctx context.Context, f Fetcher, url string) (io.ReadCloser, string, error) {
+	if streamer, streams := f.(StreamFetcher); streams {
+		return streamer.FetchStream(ctx, url)
+	}
+
+	body, finalURL, err := f.Fetch(ctx, url)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return ioutil.NopCloser(bytes.NewReader(body)), finalURL, nil
+}
+
+// closingBody : stream that calls a function once it is closed, e.g. to free the connection or
+// cancel the context it was fetched with
+type closingBody struct {
+	io.ReadCloser
+	once  sync.Once
+	close func()
+}
+
+// Close : Closes the stream and calls the function
+func (b *closingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.close)
+	return err
+}
+
+// HTTPFetcher : Fetcher that downloads pages over HTTP
+type HTTPFetcher struct {
+	netClient   *http.Client
+	userAgent   string
+	maxBodySize int64
+}
+
+// NewHTTPFetcher : Creates a new HTTP fetcher using the given client, or a client with a
+// connection pool suited to crawling a single site that accepts compressed responses if it is nil
+func NewHTTPFetcher(netClient *http.Client) *HTTPFetcher {
+	if netClient == nil {
+		netClient = &http.Client{Transport: NewDecompressTransport(NewTransport(), nil)}
+	}
+
+	return &HTTPFetcher{netClient: netClient}
+}
+
+// NewTransport : Creates the transport used by NewHTTPFetcher when it isn't given a client, with
+// a connection pool suited to crawling a single site. It leaves compression to DecompressTransport
+func NewTransport() *http.Transport {
+	return &http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        15,
+		MaxIdleConnsPerHost: 15,
+		IdleConnTimeout:     30 * time.Second,
+		DisableCompression:  true,
+	}
+}
+
+// NewHTTPFetcherWithUserAgent : Creates a new HTTP fetcher like NewHTTPFetcher that identifies
+// itself with the given User-Agent header
+func NewHTTPFetcherWithUserAgent(netClient *http.Client, userAgent string) *HTTPFetcher {
+	f := NewHTTPFetcher(netClient)
+	f.userAgent = userAgent
+	return f
+}
+
+// NewHTTPFetcherWithMaxBodySize : Creates an HTTP fetcher failing on bodies over maxBodySize, if positive
+func NewHTTPFetcherWithMaxBodySize(netClient *http.Client, userAgent string, maxBodySize int64) *HTTPFetcher {
+	f := NewHTTPFetcherWithUserAgent(netClient, userAgent)
+	f.maxBodySize = maxBodySize
+	return f
+}
+
+// Fetch : Downloads the page at the given URL, following redirects. A response with a status
+// other than 2xx is returned as a StatusError
+func (f *HTTPFetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	resp, err := f.get(ctx, url)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer resp.Body.Close()
+	body, err := f.readBody(url, resp)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, resp.Request.URL.String(), nil
+}
+
+// FetchStream : Downloads the page at the given URL like Fetch, returning its body as it arrives.
+// Reading more than the max body size fails with a BodyTooLargeError
+func (f *HTTPFetcher) FetchStream(ctx context.Context, url string) (io.ReadCloser, string, error) {
+	resp, err := f.get(ctx, url)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if f.maxBodySize <= 0 {
+		return resp.Body, resp.Request.URL.String(), nil
+	}
+
+	if resp.ContentLength > f.maxBodySize {
+		resp.Body.Close()
+		return nil, "", &BodyTooLargeError{URL: url, Limit: f.maxBodySize}
+	}
+
+	return &limitedBody{ReadCloser: resp.Body, url: url, limit: f.maxBodySize}, resp.Request.URL.String(), nil
+}
+
+// get : Sends a GET request for the given URL, returning the response if its status is 2xx
+func (f *HTTPFetcher) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+
+	resp, err := f.netClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		retryAfter := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		return nil, &StatusError{URL: url, Code: resp.StatusCode, RetryAfter: retryAfter}
+	}
+
+	return resp, nil
+}
+
+// readBody : Reads the body of a response, failing as soon as it exceeds the max body size
+func (f *HTTPFetcher) readBody(url string, resp *http.Response) ([]byte, error) {
+	if f.maxBodySize <= 0 {
+		return ioutil.ReadAll(resp.Body)
+	}
+
+	if resp.ContentLength > f.maxBodySize {
+		return nil, &BodyTooLargeError{URL: url, Limit: f.maxBodySize}
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, f.maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if int64(len(body)) > f.maxBodySize {
+		return nil, &BodyTooLargeError{URL: url, Limit: f.maxBodySize}
+	}
+
+	return body, nil
+}
+
+// limitedBody : response body that fails with a BodyTooLargeError once more than limit bytes
+// have been read from it
+type limitedBody struct {
+	io.ReadCloser
+	url   string
+	limit int64
+	read  int64
+}
+
+// Read : Reads from the body, failing instead of reading past the limit
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if left := b.limit + 1 - b.read; int64(len(p)) > left {
+		p = p[:left]
+	}
+
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return 0, &BodyTooLargeError{URL: b.url, Limit: b.limit}
+	}
+
+	return n, err
+}
+
+// parseRetryAfter : Gets the delay given by a Retry-After header, either in seconds or as an
+// HTTP date, or zero if the header is missing or malformed
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(header); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	date, err := http.ParseTime(header)
+	if err != nil || !date.After(now) {
+		return 0
+	}
+
+	return date.Sub(now)
+}
+
+// FileFetcher : Fetcher that reads pages from the local filesystem, treating URLs as paths
+type FileFetcher struct {
+	root string
+}
+
+// NewFileFetcher : Creates a new file fetcher that resolves paths relative to the given root directory
+func NewFileFetcher(root string) *FileFetcher {
+	return &FileFetcher{root: root}
+}
+
+// Fetch : Reads the file at the given path
+func (f *FileFetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	body, err := ioutil.ReadFile(filepath.Join(f.root, filepath.FromSlash(url)))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return body, url, nil
+}
+
+// MapFetcher : Fetcher that serves pages from an in-memory map of URLs to HTML
+type MapFetcher struct {
+	pages map[string]string
+}
+
+// NewMapFetcher : Creates a new map fetcher serving the given pages
+func NewMapFetcher(pages map[string]string) *MapFetcher {
+	return &MapFetcher{pages: pages}
+}
+
+// Fetch : Gets the page stored for the given URL
+func (f *MapFetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	htm, exists := f.pages[url]
+	if !exists {
+		return nil, "", ErrNotFound
+	}
+
+	return []byte(htm), url, nil
+}
@@ -0,0 +1,803 @@
+package fetcher
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func assertFetched(t *testing.T, f Fetcher, url string, expectedBody string, expectedURL string) {
+	t.Helper()
+
+	body, finalURL, err := f.Fetch(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(body) != expectedBody {
+		t.Errorf("Expected '%q' but got '%q'", expectedBody, string(body))
+	}
+
+	if finalURL != expectedURL {
+		t.Errorf("Expected '%q' but got '%q'", expectedURL, finalURL)
+	}
+}
+
+func assertStreamed(t *testing.T, f StreamFetcher, url string, expectedBody string, expectedURL string) {
+	t.Helper()
+
+	body, finalURL, err := f.FetchStream(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+
+	read, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(read) != expectedBody {
+		t.Errorf("Expected '%q' but got '%q'", expectedBody, string(read))
+	}
+
+	if finalURL != expectedURL {
+		t.Errorf("Expected '%q' but got '%q'", expectedURL, finalURL)
+	}
+}
+
+func TestHTTPFetcher(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/wiki/Foo":
+			fmt.Fprint(w, "<title>Foo</title>")
+		case "/wiki/Redirect":
+			http.Redirect(w, r, "/wiki/Foo", http.StatusMovedPermanently)
+		case "/wiki/Busy":
+			w.Header().Set("Retry-After", "120")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("Fetch a page", func(t *testing.T) {
+		assertFetched(t, NewHTTPFetcher(server.Client()), server.URL+"/wiki/Foo", "<title>Foo</title>", server.URL+"/wiki/Foo")
+	})
+
+	t.Run("Report the URL after redirects", func(t *testing.T) {
+		assertFetched(t, NewHTTPFetcher(server.Client()), server.URL+"/wiki/Redirect", "<title>Foo</title>", server.URL+"/wiki/Foo")
+	})
+
+	t.Run("Report a server asking to back off", func(t *testing.T) {
+		_, _, err := NewHTTPFetcher(server.Client()).Fetch(context.Background(), server.URL+"/wiki/Busy")
+
+		var statusErr *StatusError
+		if !errors.As(err, &statusErr) {
+			t.Fatalf("Expected a status error but got '%v'", err)
+		}
+
+		if statusErr.Code != http.StatusTooManyRequests || statusErr.RetryAfter != 2*time.Minute {
+			t.Errorf("Expected a 429 with a 2m Retry-After but got %+v", statusErr)
+		}
+	})
+
+	t.Run("Report a missing page", func(t *testing.T) {
+		_, _, err := NewHTTPFetcher(server.Client()).Fetch(context.Background(), server.URL+"/wiki/Missing")
+
+		if !errors.Is(err, ErrNotFound) || IsTransient(err) {
+			t.Errorf("Expected a permanent '%v' but got '%v'", ErrNotFound, err)
+		}
+	})
+
+	t.Run("Cancelled fetch", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, _, err := NewHTTPFetcher(nil).Fetch(ctx, server.URL+"/wiki/Foo"); err == nil {
+			t.Error("Expected an error from a cancelled fetch")
+		}
+	})
+}
+
+func TestStreamFetchers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/wiki/Foo":
+			fmt.Fprint(w, "<title>Foo</title>")
+		case "/wiki/Redirect":
+			http.Redirect(w, r, "/wiki/Foo", http.StatusMovedPermanently)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	t.Run("Stream a page over HTTP", func(t *testing.T) {
+		assertStreamed(t, NewHTTPFetcher(server.Client()), server.URL+"/wiki/Redirect", "<title>Foo</title>", server.URL+"/wiki/Foo")
+	})
+
+	t.Run("Report a missing page before streaming", func(t *testing.T) {
+		_, _, err := NewHTTPFetcher(server.Client()).FetchStream(context.Background(), server.URL+"/wiki/Missing")
+
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("Expected '%v' but got '%v'", ErrNotFound, err)
+		}
+	})
+
+	t.Run("Stream from a fetcher that can't", func(t *testing.T) {
+		body, finalURL, err := Stream(context.Background(), NewMapFetcher(map[string]string{"page": "<title>Page</title>"}), "page")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		read, _ := ioutil.ReadAll(body)
+		if string(read) != "<title>Page</title>" || finalURL != "page" {
+			t.Errorf("Expected the stored page but got '%q' from '%q'", string(read), finalURL)
+		}
+	})
+
+	t.Run("Wrappers stream through", func(t *testing.T) {
+		f := NewRobotsFetcher(NewRetryFetcher(NewPoliteFetcher(NewHTTPFetcher(server.Client()), HostLimits{MaxConns: 1}),
+			RetryPolicy{MaxAttempts: 2, AttemptTimeout: time.Minute}), "WikiGo/1.0")
+
+		assertStreamed(t, f, server.URL+"/wiki/Foo", "<title>Foo</title>", server.URL+"/wiki/Foo")
+	})
+
+	t.Run("Keep the connection to the host until the body is closed", func(t *testing.T) {
+		f := NewPoliteFetcher(&TestStatusFetcher{}, HostLimits{MaxConns: 1})
+
+		body, _, err := f.FetchStream(context.Background(), "https://a.example/wiki/Page")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		if _, _, err := f.FetchStream(ctx, "https://a.example/wiki/Page"); err != context.DeadlineExceeded {
+			t.Errorf("Expected the second stream to wait for the connection but got '%v'", err)
+		}
+
+		body.Close()
+		assertStreamed(t, f, "https://a.example/wiki/Page", "<title>Page</title>", "https://a.example/wiki/Page")
+	})
+
+	t.Run("Retry streams that failed to start", func(t *testing.T) {
+		pages := &TestStatusFetcher{errs: []error{&StatusError{Code: http.StatusBadGateway}}}
+		f := NewRetryFetcher(pages, RetryPolicy{MaxAttempts: 2, MaxDelay: time.Millisecond})
+
+		assertStreamed(t, f, "page", "<title>Page</title>", "page")
+	})
+
+	t.Run("Skip disallowed streams", func(t *testing.T) {
+		f := NewRobotsFetcher(NewMapFetcher(map[string]string{
+			"https://a.example/robots.txt": "User-agent: *\nDisallow: /wiki/B",
+		}), "WikiGo/1.0")
+
+		if _, _, err := f.FetchStream(context.Background(), "https://a.example/wiki/B"); !errors.Is(err, ErrDisallowedByRobots) {
+			t.Errorf("Expected '%v' but got '%v'", ErrDisallowedByRobots, err)
+		}
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, time.April, 1, 12, 0, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"30":                            30 * time.Second,
+		"-5":                            0,
+		"soon":                          0,
+		"Wed, 01 Apr 2020 12:01:00 GMT": time.Minute,
+		"Wed, 01 Apr 2020 11:00:00 GMT": 0,
+	}
+
+	for header, expected := range cases {
+		if delay := parseRetryAfter(header, now); delay != expected {
+			t.Errorf("Expected %v for '%s' but got %v", expected, header, delay)
+		}
+	}
+}
+
+func TestFileFetcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ioutil.WriteFile(filepath.Join(dir, "page1.html"), []byte("<title>Page 1</title>"), 0644)
+
+	t.Run("Read a file relative to the root", func(t *testing.T) {
+		assertFetched(t, NewFileFetcher(dir), "page1.html", "<title>Page 1</title>", "page1.html")
+	})
+
+	t.Run("Missing file", func(t *testing.T) {
+		_, _, err := NewFileFetcher(dir).Fetch(context.Background(), "page2.html")
+		if !os.IsNotExist(err) {
+			t.Errorf("Expected a not exist error but got '%v'", err)
+		}
+	})
+}
+
+func TestMapFetcher(t *testing.T) {
+	f := NewMapFetcher(map[string]string{"page1": "<title>Page 1</title>"})
+
+	t.Run("Fetch a stored page", func(t *testing.T) {
+		assertFetched(t, f, "page1", "<title>Page 1</title>", "page1")
+	})
+
+	t.Run("Missing page", func(t *testing.T) {
+		if _, _, err := f.Fetch(context.Background(), "page2"); err != ErrNotFound {
+			t.Errorf("Expected '%v' but got '%v'", ErrNotFound, err)
+		}
+	})
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fetcher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recorder := NewRecorder(NewMapFetcher(map[string]string{
+		"page1": "<title>Page 1</title>",
+		"page2": "<title>Page 2</title>",
+	}))
+	recorder.Fetch(context.Background(), "page1")
+	recorder.Fetch(context.Background(), "page3")
+
+	path := filepath.Join(dir, "recording.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := LoadReplayFetcher(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("Replay a recorded page", func(t *testing.T) {
+		assertFetched(t, replay, "page1", "<title>Page 1</title>", "page1")
+	})
+
+	t.Run("Pages that were never fetched are not replayed", func(t *testing.T) {
+		if _, _, err := replay.Fetch(context.Background(), "page2"); err != ErrNotFound {
+			t.Errorf("Expected '%v' but got '%v'", ErrNotFound, err)
+		}
+	})
+}
+
+// TestStatusFetcher : Fetcher that fails with the given errors before serving its page
+type TestStatusFetcher struct {
+	mux      sync.Mutex
+	errs     []error
+	inFlight int
+	maxSeen  int
+	delay    time.Duration
+}
+
+func (f *TestStatusFetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	f.mux.Lock()
+	f.inFlight++
+	if f.inFlight > f.maxSeen {
+		f.maxSeen = f.inFlight
+	}
+	var err error
+	if len(f.errs) > 0 {
+		err, f.errs = f.errs[0], f.errs[1:]
+	}
+	f.mux.Unlock()
+
+	time.Sleep(f.delay)
+
+	f.mux.Lock()
+	f.inFlight--
+	f.mux.Unlock()
+
+	if err != nil {
+		return nil, "", err
+	}
+
+	return []byte("<title>Page</title>"), url, nil
+}
+
+func TestPoliteFetcher(t *testing.T) {
+	t.Run("Limit the request rate of a host", func(t *testing.T) {
+		f := NewPoliteFetcher(&TestStatusFetcher{}, HostLimits{RequestsPerSecond: 20, Burst: 1})
+
+		started := time.Now()
+		for i := 0; i < 3; i++ {
+			assertFetched(t, f, "https://a.example/wiki/Page", "<title>Page</title>", "https://a.example/wiki/Page")
+		}
+
+		if elapsed := time.Since(started); elapsed < 90*time.Millisecond {
+			t.Errorf("Expected 3 requests at 20 per second to take 100ms but took %v", elapsed)
+		}
+	})
+
+	t.Run("Hosts have separate buckets", func(t *testing.T) {
+		f := NewPoliteFetcher(&TestStatusFetcher{}, HostLimits{RequestsPerSecond: 1, Burst: 1})
+
+		started := time.Now()
+		assertFetched(t, f, "https://a.example/wiki/Page", "<title>Page</title>", "https://a.example/wiki/Page")
+		assertFetched(t, f, "https://b.example/wiki/Page", "<title>Page</title>", "https://b.example/wiki/Page")
+
+		if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+			t.Errorf("Expected requests to different hosts not to wait but took %v", elapsed)
+		}
+	})
+
+	t.Run("Limit the connections to a host", func(t *testing.T) {
+		pages := &TestStatusFetcher{delay: 10 * time.Millisecond}
+		f := NewPoliteFetcher(pages, HostLimits{MaxConns: 2})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				f.Fetch(context.Background(), "https://a.example/wiki/Page")
+			}()
+		}
+		wg.Wait()
+
+		if pages.maxSeen != 2 {
+			t.Errorf("Expected at most 2 requests in flight but saw %d", pages.maxSeen)
+		}
+	})
+
+	t.Run("Wait out Retry-After and retry", func(t *testing.T) {
+		pages := &TestStatusFetcher{errs: []error{
+			&StatusError{Code: http.StatusTooManyRequests, RetryAfter: 50 * time.Millisecond},
+		}}
+		f := NewPoliteFetcher(pages, HostLimits{MaxRetries: 1})
+
+		started := time.Now()
+		assertFetched(t, f, "https://a.example/wiki/Page", "<title>Page</title>", "https://a.example/wiki/Page")
+
+		if elapsed := time.Since(started); elapsed < 50*time.Millisecond {
+			t.Errorf("Expected the retry to wait 50ms but took %v", elapsed)
+		}
+	})
+
+	t.Run("Give up after the max retries", func(t *testing.T) {
+		tooMany := &StatusError{Code: http.StatusTooManyRequests, RetryAfter: time.Millisecond}
+		f := NewPoliteFetcher(&TestStatusFetcher{errs: []error{tooMany, tooMany}}, HostLimits{MaxRetries: 1})
+
+		if _, _, err := f.Fetch(context.Background(), "https://a.example/wiki/Page"); err != tooMany {
+			t.Errorf("Expected '%v' but got '%v'", tooMany, err)
+		}
+	})
+
+	t.Run("Don't wait out a Retry-After longer than the max", func(t *testing.T) {
+		tooMany := &StatusError{Code: http.StatusTooManyRequests, RetryAfter: time.Hour}
+		f := NewPoliteFetcher(&TestStatusFetcher{errs: []error{tooMany}}, HostLimits{MaxRetries: 3, MaxRetryAfter: time.Minute})
+
+		if _, _, err := f.Fetch(context.Background(), "https://a.example/wiki/Page"); err != tooMany {
+			t.Errorf("Expected '%v' but got '%v'", tooMany, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		if _, _, err := f.Fetch(ctx, "https://a.example/wiki/Page"); err != context.DeadlineExceeded {
+			t.Errorf("Expected the host to stay blocked but got '%v'", err)
+		}
+	})
+}
+
+func TestParseRobots(t *testing.T) {
+	robots := `# robots.txt for a wiki
+User-agent: *
+Disallow: /w/
+Disallow: /wiki/Special:
+Allow: /w/load.php
+
+User-agent: WikiGo
+User-agent: OtherBot
+Disallow: /wiki/Secret
+Disallow: /*.pdf$
+Crawl-delay: 1.5
+`
+
+	t.Run("Rules of the named group", func(t *testing.T) {
+		rules := ParseRobots(robots, "wikigo")
+		cases := map[string]bool{
+			"/wiki/Fife":        true,
+			"/w/index.php":      true,
+			"/wiki/Secret_page": false,
+			"/files/a.pdf":      false,
+			"/files/a.pdf?x=1":  true,
+		}
+
+		for path, expected := range cases {
+			if allowed := rules.Allowed(path); allowed != expected {
+				t.Errorf("Expected %t for '%s' but got %t", expected, path, allowed)
+			}
+		}
+
+		if rules.CrawlDelay != 1500*time.Millisecond {
+			t.Errorf("Expected a crawl delay of 1.5s but got %v", rules.CrawlDelay)
+		}
+	})
+
+	t.Run("Rules of the * group", func(t *testing.T) {
+		rules := ParseRobots(robots, "somebot")
+		cases := map[string]bool{
+			"/wiki/Fife":         true,
+			"/w/index.php":       false,
+			"/w/load.php?x=1":    true,
+			"/wiki/Special:Page": false,
+		}
+
+		for path, expected := range cases {
+			if allowed := rules.Allowed(path); allowed != expected {
+				t.Errorf("Expected %t for '%s' but got %t", expected, path, allowed)
+			}
+		}
+	})
+}
+
+func TestRobotsFetcher(t *testing.T) {
+	t.Run("Skip disallowed pages", func(t *testing.T) {
+		f := NewRobotsFetcher(NewMapFetcher(map[string]string{
+			"https://a.example/robots.txt": "User-agent: wikigo\nDisallow: /wiki/B",
+			"https://a.example/wiki/A":     "<title>A</title>",
+			"https://a.example/wiki/B":     "<title>B</title>",
+		}), "WikiGo/1.0 (me@example.com)")
+
+		assertFetched(t, f, "https://a.example/wiki/A", "<title>A</title>", "https://a.example/wiki/A")
+
+		if _, _, err := f.Fetch(context.Background(), "https://a.example/wiki/B"); !errors.Is(err, ErrDisallowedByRobots) {
+			t.Errorf("Expected '%v' but got '%v'", ErrDisallowedByRobots, err)
+		}
+	})
+
+	t.Run("Missing robots.txt allows everything", func(t *testing.T) {
+		f := NewRobotsFetcher(NewMapFetcher(map[string]string{
+			"https://a.example/wiki/A": "<title>A</title>",
+		}), "WikiGo/1.0")
+
+		assertFetched(t, f, "https://a.example/wiki/A", "<title>A</title>", "https://a.example/wiki/A")
+	})
+
+	t.Run("Fetch robots.txt once per host", func(t *testing.T) {
+		requests := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/robots.txt" {
+				requests++
+				fmt.Fprint(w, "User-agent: *\nCrawl-delay: 0.05\n")
+				return
+			}
+			fmt.Fprint(w, "<title>Page</title>")
+		}))
+		defer server.Close()
+
+		f := NewRobotsFetcher(NewHTTPFetcher(server.Client()), "WikiGo/1.0")
+
+		started := time.Now()
+		for i := 0; i < 3; i++ {
+			assertFetched(t, f, server.URL+"/wiki/A", "<title>Page</title>", server.URL+"/wiki/A")
+		}
+
+		if requests != 1 {
+			t.Errorf("Expected robots.txt to be fetched once but it was fetched %d times", requests)
+		}
+
+		if elapsed := time.Since(started); elapsed < 100*time.Millisecond {
+			t.Errorf("Expected the crawl delay to space 3 requests over 100ms but took %v", elapsed)
+		}
+	})
+}
+
+func TestIsTransient(t *testing.T) {
+	cases := map[error]bool{
+		&StatusError{Code: http.StatusTooManyRequests}:       true,
+		&StatusError{Code: http.StatusBadGateway}:            true,
+		&StatusError{Code: http.StatusNotFound}:              false,
+		&StatusError{Code: http.StatusGone}:                  false,
+		fmt.Errorf("fetching: %w", context.DeadlineExceeded): true,
+		ErrNotFound:           false,
+		ErrDisallowedByRobots: false,
+	}
+
+	for err, expected := range cases {
+		if transient := IsTransient(err); transient != expected {
+			t.Errorf("Expected %t for '%v' but got %t", expected, err, transient)
+		}
+	}
+}
+
+func TestRetryFetcher(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+	t.Run("Retry transient failures", func(t *testing.T) {
+		pages := &TestStatusFetcher{errs: []error{
+			&StatusError{Code: http.StatusBadGateway},
+			&StatusError{Code: http.StatusServiceUnavailable},
+		}}
+
+		assertFetched(t, NewRetryFetcher(pages, policy), "page", "<title>Page</title>", "page")
+	})
+
+	t.Run("Give up after the max attempts", func(t *testing.T) {
+		unavailable := &StatusError{Code: http.StatusServiceUnavailable}
+		pages := &TestStatusFetcher{errs: []error{unavailable, unavailable, unavailable}}
+
+		if _, _, err := NewRetryFetcher(pages, policy).Fetch(context.Background(), "page"); err != unavailable {
+			t.Errorf("Expected '%v' but got '%v'", unavailable, err)
+		}
+	})
+
+	t.Run("Don't retry permanent failures", func(t *testing.T) {
+		gone := &StatusError{Code: http.StatusGone}
+		pages := &TestStatusFetcher{errs: []error{gone}}
+
+		if _, _, err := NewRetryFetcher(pages, policy).Fetch(context.Background(), "page"); err != gone {
+			t.Errorf("Expected '%v' but got '%v'", gone, err)
+		}
+	})
+
+	t.Run("Don't wait out a Retry-After longer than the max delay", func(t *testing.T) {
+		tooMany := &StatusError{Code: http.StatusTooManyRequests, RetryAfter: time.Hour}
+		pages := &TestStatusFetcher{errs: []error{tooMany}}
+
+		if _, _, err := NewRetryFetcher(pages, policy).Fetch(context.Background(), "page"); err != tooMany {
+			t.Errorf("Expected '%v' but got '%v'", tooMany, err)
+		}
+	})
+
+	t.Run("Retry attempts that time out", func(t *testing.T) {
+		timeouts := NewRetryFetcher(&TestSlowFetcher{fetcher: &TestStatusFetcher{}, slowFetches: 1}, RetryPolicy{
+			MaxAttempts: 2, MaxDelay: time.Millisecond, AttemptTimeout: 50 * time.Millisecond})
+
+		assertFetched(t, timeouts, "page", "<title>Page</title>", "page")
+	})
+}
+
+// TestSlowFetcher : Fetcher that hangs until its context is done on its first fetches
+type TestSlowFetcher struct {
+	fetcher     Fetcher
+	slowFetches int
+}
+
+func (f *TestSlowFetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	if f.slowFetches > 0 {
+		f.slowFetches--
+		<-ctx.Done()
+		return nil, "", ctx.Err()
+	}
+
+	return f.fetcher.Fetch(ctx, url)
+}
+
+func TestCacheTransport(t *testing.T) {
+	requests := 0
+	revalidated := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("ETag", `"v1"`)
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			revalidated++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if r.URL.Path == "/wiki/Big" && strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			w.Header().Set("Content-Encoding", "gzip")
+			writer := gzip.NewWriter(w)
+			fmt.Fprint(writer, strings.Repeat("<p>Fife</p>", 1000))
+			writer.Close()
+			return
+		}
+		fmt.Fprint(w, "<title>"+r.URL.Path+"</title>")
+	}))
+	defer server.Close()
+
+	newCachedFetcher := func(t *testing.T, dir string, policy CachePolicy) *HTTPFetcher {
+		t.Helper()
+
+		cache, err := NewCacheTransport(dir, server.Client().Transport, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return NewHTTPFetcher(&http.Client{Transport: cache})
+	}
+
+	t.Run("Serve fresh pages from disk", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "cache")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		requests = 0
+
+		assertFetched(t, newCachedFetcher(t, dir, CachePolicy{TTL: time.Hour}), server.URL+"/wiki/A", "<title>/wiki/A</title>", server.URL+"/wiki/A")
+		assertFetched(t, newCachedFetcher(t, dir, CachePolicy{TTL: time.Hour}), server.URL+"/wiki/A", "<title>/wiki/A</title>", server.URL+"/wiki/A")
+
+		if requests != 1 {
+			t.Errorf("Expected 1 request but got %d", requests)
+		}
+	})
+
+	t.Run("Revalidate stale pages", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "cache")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		requests, revalidated = 0, 0
+
+		f := newCachedFetcher(t, dir, CachePolicy{})
+		assertFetched(t, f, server.URL+"/wiki/A", "<title>/wiki/A</title>", server.URL+"/wiki/A")
+		assertFetched(t, f, server.URL+"/wiki/A", "<title>/wiki/A</title>", server.URL+"/wiki/A")
+
+		if requests != 2 || revalidated != 1 {
+			t.Errorf("Expected 2 requests with 1 revalidated but got %d and %d", requests, revalidated)
+		}
+	})
+
+	t.Run("Don't read or store bodies larger than the max body size", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "cache")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		client := &http.Client{Transport: NewDecompressTransport(server.Client().Transport, nil)}
+		cache, err := NewCacheTransport(dir, client.Transport, CachePolicy{TTL: time.Hour, MaxBodySize: 100})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = NewHTTPFetcher(&http.Client{Transport: cache}).Fetch(context.Background(), server.URL+"/wiki/Big")
+
+		var tooLarge *BodyTooLargeError
+		if !errors.As(err, &tooLarge) || tooLarge.Limit != 100 {
+			t.Errorf("Expected a body too large error but got '%v'", err)
+		}
+
+		if files, _ := ioutil.ReadDir(dir); len(files) != 0 {
+			t.Errorf("Expected nothing to be stored but got %d files", len(files))
+		}
+	})
+
+	t.Run("Evict the least recently used pages", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "cache")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+
+		assertFetched(t, newCachedFetcher(t, dir, CachePolicy{TTL: time.Hour}), server.URL+"/wiki/A", "<title>/wiki/A</title>", server.URL+"/wiki/A")
+		files, err := ioutil.ReadDir(dir)
+		if err != nil || len(files) != 1 {
+			t.Fatalf("Expected 1 cached page but got %d: %v", len(files), err)
+		}
+
+		f := newCachedFetcher(t, dir, CachePolicy{TTL: time.Hour, MaxBytes: files[0].Size() * 3 / 2})
+		assertFetched(t, f, server.URL+"/wiki/B", "<title>/wiki/B</title>", server.URL+"/wiki/B")
+
+		evicted := filepath.Join(dir, cacheKey(server.URL+"/wiki/A")+".json")
+		if _, err := os.Stat(evicted); !os.IsNotExist(err) {
+			t.Errorf("Expected the first page to be evicted but got '%v'", err)
+		}
+
+		kept := filepath.Join(dir, cacheKey(server.URL+"/wiki/B")+".json")
+		if _, err := os.Stat(kept); err != nil {
+			t.Errorf("Expected the last page to be kept but got '%v'", err)
+		}
+	})
+}
+
+func TestMaxAge(t *testing.T) {
+	cases := map[string]int64{
+		"":                               0,
+		"max-age=60":                     60,
+		"public, max-age=300":            300,
+		"no-cache, max-age=60":           0,
+		"private, s-maxage=0, max-age=0": 0,
+	}
+
+	for cacheControl, expected := range cases {
+		header := http.Header{"Cache-Control": []string{cacheControl}}
+		if seconds := maxAge(header); seconds != expected {
+			t.Errorf("Expected %d for '%s' but got %d", expected, cacheControl, seconds)
+		}
+	}
+}
+
+func TestDecompressTransport(t *testing.T) {
+	page := strings.Repeat("<p>Fife</p>", 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/plain" || !strings.Contains(r.Header.Get("Accept-Encoding"), "gzip"):
+			fmt.Fprint(w, page)
+		case r.URL.Path == "/upper":
+			w.Header().Set("Content-Encoding", "x-lower")
+			fmt.Fprint(w, strings.ToLower(page))
+		default:
+			w.Header().Set("Content-Encoding", "gzip")
+			writer := gzip.NewWriter(w)
+			fmt.Fprint(writer, page)
+			writer.Close()
+		}
+	}))
+	defer server.Close()
+
+	t.Run("Decode gzip responses", func(t *testing.T) {
+		f := NewHTTPFetcher(&http.Client{Transport: NewDecompressTransport(server.Client().Transport, nil)})
+		assertFetched(t, f, server.URL+"/gzip", page, server.URL+"/gzip")
+	})
+
+	t.Run("Pass uncompressed responses through", func(t *testing.T) {
+		f := NewHTTPFetcher(&http.Client{Transport: NewDecompressTransport(server.Client().Transport, nil)})
+		assertFetched(t, f, server.URL+"/plain", page, server.URL+"/plain")
+	})
+
+	t.Run("Decode with a registered decoder", func(t *testing.T) {
+		decoders := DefaultDecoders()
+		decoders["x-lower"] = func(body io.Reader) (io.ReadCloser, error) {
+			lower, err := ioutil.ReadAll(body)
+			return ioutil.NopCloser(strings.NewReader(strings.Replace(string(lower), "fife", "Fife", -1))), err
+		}
+
+		f := NewHTTPFetcher(&http.Client{Transport: NewDecompressTransport(server.Client().Transport, decoders)})
+		assertFetched(t, f, server.URL+"/upper", page, server.URL+"/upper")
+	})
+
+	t.Run("Unsupported encoding", func(t *testing.T) {
+		f := NewHTTPFetcher(&http.Client{Transport: NewDecompressTransport(server.Client().Transport, nil)})
+		if _, _, err := f.Fetch(context.Background(), server.URL+"/upper"); err == nil {
+			t.Error("Expected an error for an encoding without a decoder")
+		}
+	})
+
+	t.Run("Limit the decoded body size", func(t *testing.T) {
+		client := &http.Client{Transport: NewDecompressTransport(server.Client().Transport, nil)}
+		_, _, err := NewHTTPFetcherWithMaxBodySize(client, "", 100).Fetch(context.Background(), server.URL+"/gzip")
+
+		var tooLarge *BodyTooLargeError
+		if !errors.As(err, &tooLarge) || tooLarge.Limit != 100 || IsTransient(err) {
+			t.Errorf("Expected a body too large error but got '%v'", err)
+		}
+	})
+
+	t.Run("Limit the decoded body size of a stream", func(t *testing.T) {
+		client := &http.Client{Transport: NewDecompressTransport(server.Client().Transport, nil)}
+		body, _, err := NewHTTPFetcherWithMaxBodySize(client, "", 100).FetchStream(context.Background(), server.URL+"/gzip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer body.Close()
+
+		read, err := ioutil.ReadAll(body)
+
+		var tooLarge *BodyTooLargeError
+		if !errors.As(err, &tooLarge) || len(read) > 100 {
+			t.Errorf("Expected a body too large error after at most 100 bytes but got '%v' after %d", err, len(read))
+		}
+	})
+
+	t.Run("Limit the body size from its length", func(t *testing.T) {
+		_, _, err := NewHTTPFetcherWithMaxBodySize(server.Client(), "", 100).Fetch(context.Background(), server.URL+"/plain")
+
+		var tooLarge *BodyTooLargeError
+		if !errors.As(err, &tooLarge) {
+			t.Errorf("Expected a body too large error but got '%v'", err)
+		}
+	})
+}
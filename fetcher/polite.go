@@ -0,0 +1,230 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
+)
+
+// HostLimits : limits a PoliteFetcher applies to each host separately. A zero RequestsPerSecond
+// or MaxConns leaves that limit off
+type HostLimits struct {
+	// RequestsPerSecond : rate at which the token bucket of a host refills
+	RequestsPerSecond float64
+	// Burst : number of requests a host can be sent at once after it has been idle
+	Burst int
+	// MaxConns : max number of requests in flight to a host
+	MaxConns int
+	// MaxRetries : max number of times a request the server asked to back off from is retried
+	MaxRetries int
+	// MaxRetryAfter : longest Retry-After that is waited out before retrying. Longer delays still
+	// hold back the host but the request fails with the server's StatusError
+	MaxRetryAfter time.Duration
+}
+
+// PoliteFetcher : Fetcher that wraps another fetcher and limits how hard each host is hit
+type PoliteFetcher struct {
+	fetcher Fetcher
+	limits  HostLimits
+	mux     sync.Mutex
+	hosts   map[string]*hostLimiter
+}
+
+// hostLimiter : the politeness state of a single host
+type hostLimiter struct {
+	conns        chan bool
+	mux          sync.Mutex
+	tokens       float64
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// NewPoliteFetcher : Creates a new polite fetcher applying the given limits around the given fetcher
+func NewPoliteFetcher(fetcher Fetcher, limits HostLimits) *PoliteFetcher {
+	return &PoliteFetcher{fetcher: fetcher, limits: limits, hosts: make(map[string]*hostLimiter)}
+}
+
+// Fetch : Waits until the host of the URL may be sent another request, then fetches the page
+// with the wrapped fetcher, waiting out and retrying requests the server asked to back off from
+func (f *PoliteFetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	host := f.host(url)
+
+	for attempt := 0; ; attempt++ {
+		body, finalURL, err := f.fetchOnce(ctx, host, url)
+		if !f.backOff(host, attempt, err) {
+			return body, finalURL, err
+		}
+	}
+}
+
+// FetchStream : Streams the page like Fetch, with Stream on the wrapped fetcher. The connection to
+// the host is counted against its limit until the body is closed
+func (f *PoliteFetcher) FetchStream(ctx context.Context, url string) (io.ReadCloser, string, error) {
+	host := f.host(url)
+
+	for attempt := 0; ; attempt++ {
+		body, finalURL, err := f.streamOnce(ctx, host, url)
+		if !f.backOff(host, attempt, err) {
+			return body, finalURL, err
+		}
+	}
+}
+
+// backOff : Leaves the host alone for as long as a server that failed the given attempt asked,
+// reporting whether the request should be sent again once it may
+func (f *PoliteFetcher) backOff(host *hostLimiter, attempt int, err error) bool {
+	var statusErr *StatusError
+	if !errors.As(err, &statusErr) || !statusErr.backOff() {
+		return false
+	}
+
+	delay := statusErr.RetryAfter
+	if delay == 0 {
+		delay = time.Second << uint(attempt)
+	}
+	host.block(time.Now().Add(delay))
+
+	return attempt < f.limits.MaxRetries && (f.limits.MaxRetryAfter <= 0 || delay <= f.limits.MaxRetryAfter)
+}
+
+// fetchOnce : Fetches the page with the wrapped fetcher once its host has a free connection and
+// a token
+func (f *PoliteFetcher) fetchOnce(ctx context.Context, host *hostLimiter, url string) ([]byte, string, error) {
+	release, err := host.acquire(ctx, f.limits)
+	if err != nil {
+		return nil, "", err
+	}
+
+	defer release()
+	return f.fetcher.Fetch(ctx, url)
+}
+
+// streamOnce : Streams the page with the wrapped fetcher once its host has a free connection and
+// a token, keeping the connection until the body is closed
+func (f *PoliteFetcher) streamOnce(ctx context.Context, host *hostLimiter, url string) (io.ReadCloser, string, error) {
+	release, err := host.acquire(ctx, f.limits)
+	if err != nil {
+		return nil, "", err
+	}
+
+	body, finalURL, err := Stream(ctx, f.fetcher, url)
+	if err != nil {
+		release()
+		return nil, "", err
+	}
+
+	return &closingBody{ReadCloser: body, close: release}, finalURL, nil
+}
+
+// host : Gets the limiter of the host of the given URL, creating it on first use. URLs that
+// can't be parsed or have no host share a single limiter
+func (f *PoliteFetcher) host(url string) *hostLimiter {
+	name := ""
+	if parsed, err := neturl.Parse(url); err == nil {
+		name = parsed.Host
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	host, exists := f.hosts[name]
+	if !exists {
+		host = &hostLimiter{tokens: float64(f.limits.Burst), last: time.Now()}
+		if f.limits.MaxConns > 0 {
+			host.conns = make(chan bool, f.limits.MaxConns)
+		}
+		f.hosts[name] = host
+	}
+
+	return host
+}
+
+// acquire : Waits for a free connection to the host and a token, returning the function that
+// frees the connection
+func (h *hostLimiter) acquire(ctx context.Context, limits HostLimits) (func(), error) {
+	release := func() {}
+	if h.conns != nil {
+		select {
+		case h.conns <- true:
+			release = func() { <-h.conns }
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	if err := h.wait(ctx, limits); err != nil {
+		release()
+		return nil, err
+	}
+
+	return release, nil
+}
+
+// wait : Takes a token from the bucket of the host, sleeping until one is available and the
+// host is no longer blocked
+func (h *hostLimiter) wait(ctx context.Context, limits HostLimits) error {
+	delay := h.reserve(time.Now(), limits)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve : Takes a token from the bucket of the host and returns how long to wait before it
+// may be used. The bucket goes negative while requests are queued for tokens
+func (h *hostLimiter) reserve(now time.Time, limits HostLimits) time.Duration {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	start := now
+	if h.blockedUntil.After(start) {
+		start = h.blockedUntil
+	}
+
+	if limits.RequestsPerSecond <= 0 {
+		return start.Sub(now)
+	}
+
+	if start.After(h.last) {
+		h.tokens += start.Sub(h.last).Seconds() * limits.RequestsPerSecond
+		if burst := float64(limits.Burst); h.tokens > burst {
+			h.tokens = burst
+		}
+		h.last = start
+	}
+
+	h.tokens--
+	if h.tokens >= 0 {
+		return start.Sub(now)
+	}
+
+	return start.Sub(now) + time.Duration(-h.tokens/limits.RequestsPerSecond*float64(time.Second))
+}
+
+// block : Holds back every request to the host until the given time
+func (h *hostLimiter) block(until time.Time) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+
+	if until.After(h.blockedUntil) {
+		h.blockedUntil = until
+	}
+}
+
+// backOff : Reports whether the server asked the client to slow down
+func (e *StatusError) backOff() bool {
+	return e.Code == http.StatusTooManyRequests || e.Code == http.StatusServiceUnavailable
+}
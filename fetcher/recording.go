@@ -0,0 +1,100 @@
+package fetcher
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"sort"
+	"sync"
+)
+
+// Recording : a single page fetched by a Recorder
+type Recording struct {
+	URL      string `json:"url"`
+	FinalURL string `json:"finalURL"`
+	Body     string `json:"body"`
+}
+
+// Recorder : Fetcher that passes fetches through to another fetcher and remembers every page it
+// served, so that a crawl can be saved and replayed offline
+type Recorder struct {
+	fetcher    Fetcher
+	mux        sync.Mutex
+	recordings map[string]Recording
+}
+
+// NewRecorder : Creates a new recorder around the given fetcher
+func NewRecorder(fetcher Fetcher) *Recorder {
+	return &Recorder{fetcher: fetcher, recordings: make(map[string]Recording)}
+}
+
+// Fetch : Fetches the page with the wrapped fetcher and records it if successful
+func (r *Recorder) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	body, finalURL, err := r.fetcher.Fetch(ctx, url)
+	if err != nil {
+		return nil, "", err
+	}
+
+	r.mux.Lock()
+	r.recordings[url] = Recording{URL: url, FinalURL: finalURL, Body: string(body)}
+	r.mux.Unlock()
+
+	return body, finalURL, nil
+}
+
+// Save : Writes every recorded page to a JSON file that can be loaded with LoadReplayFetcher
+func (r *Recorder) Save(path string) error {
+	r.mux.Lock()
+	recordings := make([]Recording, 0, len(r.recordings))
+	for _, recording := range r.recordings {
+		recordings = append(recordings, recording)
+	}
+	r.mux.Unlock()
+
+	sort.Slice(recordings, func(i, j int) bool { return recordings[i].URL < recordings[j].URL })
+	data, err := json.MarshalIndent(recordings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// ReplayFetcher : Fetcher that serves the pages saved by a Recorder
+type ReplayFetcher struct {
+	recordings map[string]Recording
+}
+
+// LoadReplayFetcher : Creates a new replay fetcher from a file written by Recorder.Save
+func LoadReplayFetcher(path string) (*ReplayFetcher, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var recordings []Recording
+	if err := json.Unmarshal(data, &recordings); err != nil {
+		return nil, err
+	}
+
+	f := ReplayFetcher{recordings: make(map[string]Recording)}
+	for _, recording := range recordings {
+		f.recordings[recording.URL] = recording
+	}
+
+	return &f, nil
+}
+
+// Fetch : Gets the recorded page for the given URL
+func (f *ReplayFetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, "", err
+	}
+
+	recording, exists := f.recordings[url]
+	if !exists {
+		return nil, "", ErrNotFound
+	}
+
+	return []byte(recording.Body), recording.FinalURL, nil
+}
@@ -0,0 +1,142 @@
+package fetcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy : how a RetryFetcher retries transient failures. The delay before each retry is
+// drawn at random up to BaseDelay doubled for every failed attempt, capped at MaxDelay
+type RetryPolicy struct {
+	// MaxAttempts : max number of times a page is fetched, including the first attempt
+	MaxAttempts int
+	// BaseDelay : longest delay before the first retry
+	BaseDelay time.Duration
+	// MaxDelay : longest delay before any retry. A Retry-After longer than this isn't waited out
+	MaxDelay time.Duration
+	// AttemptTimeout : time limit of each attempt, or zero for none
+	AttemptTimeout time.Duration
+}
+
+// RetryFetcher : Fetcher that wraps another fetcher and retries the fetches that failed for
+// transient reasons, backing off exponentially with jitter between attempts
+type RetryFetcher struct {
+	fetcher Fetcher
+	policy  RetryPolicy
+}
+
+// NewRetryFetcher : Creates a new retry fetcher applying the given policy around the given fetcher
+func NewRetryFetcher(fetcher Fetcher, policy RetryPolicy) *RetryFetcher {
+	return &RetryFetcher{fetcher: fetcher, policy: policy}
+}
+
+// Fetch : Fetches the page with the wrapped fetcher, retrying transient failures until the
+// policy runs out of attempts. The error of the last attempt is returned
+func (f *RetryFetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	for attempt := 1; ; attempt++ {
+		body, finalURL, err := f.fetchOnce(ctx, url)
+		if !f.waitToRetry(ctx, attempt, err) {
+			return body, finalURL, err
+		}
+	}
+}
+
+// FetchStream : Streams the page like Fetch, retrying only failures before the body is returned
+func (f *RetryFetcher) FetchStream(ctx context.Context, url string) (io.ReadCloser, string, error) {
+	for attempt := 1; ; attempt++ {
+		body, finalURL, err := f.streamOnce(ctx, url)
+		if !f.waitToRetry(ctx, attempt, err) {
+			return body, finalURL, err
+		}
+	}
+}
+
+// waitToRetry : Reports whether the attempt that failed with the given error should be retried,
+// after waiting out the delay before the retry
+func (f *RetryFetcher) waitToRetry(ctx context.Context, attempt int, err error) bool {
+	if err == nil || ctx.Err() != nil || !IsTransient(err) || attempt >= f.policy.MaxAttempts {
+		return false
+	}
+
+	delay := f.policy.backoff(attempt)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+		if statusErr.RetryAfter > f.policy.MaxDelay {
+			return false
+		}
+		delay = statusErr.RetryAfter
+	}
+
+	timer := time.NewTimer(delay)
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		timer.Stop()
+		return false
+	}
+}
+
+// fetchOnce : Fetches the page with the wrapped fetcher within the time limit of an attempt
+func (f *RetryFetcher) fetchOnce(ctx context.Context, url string) ([]byte, string, error) {
+	if f.policy.AttemptTimeout <= 0 {
+		return f.fetcher.Fetch(ctx, url)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.policy.AttemptTimeout)
+	defer cancel()
+	return f.fetcher.Fetch(ctx, url)
+}
+
+// streamOnce : Streams the page with the wrapped fetcher within the time limit of an attempt,
+// which runs until the body is closed
+func (f *RetryFetcher) streamOnce(ctx context.Context, url string) (io.ReadCloser, string, error) {
+	if f.policy.AttemptTimeout <= 0 {
+		return Stream(ctx, f.fetcher, url)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, f.policy.AttemptTimeout)
+	body, finalURL, err := Stream(ctx, f.fetcher, url)
+	if err != nil {
+		cancel()
+		return nil, "", err
+	}
+
+	return &closingBody{ReadCloser: body, close: cancel}, finalURL, nil
+}
+
+// backoff : Gets a random delay before the retry following the given failed attempt
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.MaxDelay
+	if shifted := p.BaseDelay << uint(attempt-1); shifted > 0 && shifted < ceiling {
+		ceiling = shifted
+	}
+
+	if ceiling <= 0 {
+		return 0
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// IsTransient : Reports whether a fetch failed for a reason that may go away if it is retried
+func IsTransient(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Code == http.StatusTooManyRequests || statusErr.Code >= 500
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET)
+}
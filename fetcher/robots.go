@@ -0,0 +1,280 @@
+package fetcher
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDisallowedByRobots : matches the error returned when robots.txt forbids fetching a URL
+var ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+
+// RobotsFetcher : Fetcher that wraps another fetcher and only fetches URLs robots.txt allows
+type RobotsFetcher struct {
+	fetcher Fetcher
+	agent   string
+	mux     sync.Mutex
+	hosts   map[string]*robotsHost
+}
+
+// robotsHost : the robots.txt rules of a single host and when it may next be sent a request
+type robotsHost struct {
+	mux    sync.Mutex
+	rules  *RobotsRules
+	next   time.Time
+	loaded bool
+}
+
+// NewRobotsFetcher : Creates a new robots fetcher around the given fetcher, obeying the rules for
+// the product token of the given User-Agent, e.g. "wikigo" for "WikiGo/1.0 (me@example.com)"
+func NewRobotsFetcher(fetcher Fetcher, userAgent string) *RobotsFetcher {
+	return &RobotsFetcher{fetcher: fetcher, agent: productToken(userAgent), hosts: make(map[string]*robotsHost)}
+}
+
+// Fetch : Fetches the page with the wrapped fetcher if robots.txt allows it, otherwise returns an
+// error matching ErrDisallowedByRobots
+func (f *RobotsFetcher) Fetch(ctx context.Context, url string) ([]byte, string, error) {
+	if err := f.allow(ctx, url); err != nil {
+		return nil, "", err
+	}
+
+	return f.fetcher.Fetch(ctx, url)
+}
+
+// FetchStream : Streams the page like Fetch, with Stream on the wrapped fetcher
+func (f *RobotsFetcher) FetchStream(ctx context.Context, url string) (io.ReadCloser, string, error) {
+	if err := f.allow(ctx, url); err != nil {
+		return nil, "", err
+	}
+
+	return Stream(ctx, f.fetcher, url)
+}
+
+// allow : Waits until the host of the URL may be sent a request, failing with an error matching
+// ErrDisallowedByRobots if robots.txt forbids fetching the URL
+func (f *RobotsFetcher) allow(ctx context.Context, url string) error {
+	parsed, err := neturl.Parse(url)
+	if err != nil {
+		return err
+	}
+
+	host, err := f.host(ctx, parsed)
+	if err != nil {
+		return err
+	}
+
+	if !host.rules.Allowed(parsed.RequestURI()) {
+		return fmt.Errorf("%s: %w", url, ErrDisallowedByRobots)
+	}
+
+	return host.wait(ctx)
+}
+
+// host : Gets the robots.txt rules of the host of the given URL, fetching them on first use.
+// Rules that couldn't be fetched are retried by the next request to the host
+func (f *RobotsFetcher) host(ctx context.Context, url *neturl.URL) (*robotsHost, error) {
+	f.mux.Lock()
+	host, exists := f.hosts[url.Host]
+	if !exists {
+		host = &robotsHost{}
+		f.hosts[url.Host] = host
+	}
+	f.mux.Unlock()
+
+	host.mux.Lock()
+	defer host.mux.Unlock()
+
+	if host.loaded {
+		return host, nil
+	}
+
+	robotsURL := neturl.URL{Scheme: url.Scheme, Host: url.Host, Path: "/robots.txt"}
+	body, _, err := f.fetcher.Fetch(ctx, robotsURL.String())
+
+	var statusErr *StatusError
+	switch {
+	case errors.Is(err, ErrNotFound), errors.As(err, &statusErr) && statusErr.Code >= 400 && statusErr.Code < 500:
+		host.rules = &RobotsRules{}
+	case err != nil:
+		return nil, fmt.Errorf("fetching %s: %w", robotsURL.String(), err)
+	default:
+		host.rules = ParseRobots(string(body), f.agent)
+	}
+
+	host.loaded = true
+	return host, nil
+}
+
+// wait : Sleeps until the Crawl-delay of the host has passed since the last request to it
+func (h *robotsHost) wait(ctx context.Context) error {
+	if h.rules.CrawlDelay <= 0 {
+		return nil
+	}
+
+	h.mux.Lock()
+	now := time.Now()
+	start := now
+	if h.next.After(start) {
+		start = h.next
+	}
+	h.next = start.Add(h.rules.CrawlDelay)
+	h.mux.Unlock()
+
+	if !start.After(now) {
+		return nil
+	}
+
+	timer := time.NewTimer(start.Sub(now))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RobotsRules : the rules of a robots.txt file that apply to one user agent
+type RobotsRules struct {
+	allow      []string
+	disallow   []string
+	CrawlDelay time.Duration
+}
+
+// ParseRobots : Parses a robots.txt file, keeping the rules of the groups that name the given
+// product token, or the rules of the "*" group if none do
+func ParseRobots(robots string, agent string) *RobotsRules {
+	agent = strings.ToLower(agent)
+	matched := &RobotsRules{}
+	fallback := &RobotsRules{}
+	var current []*RobotsRules
+	inAgents := false
+	found := false
+
+	scanner := bufio.NewScanner(strings.NewReader(robots))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		value := strings.TrimSpace(parts[1])
+
+		if key == "user-agent" {
+			if !inAgents {
+				current = nil
+			}
+			inAgents = true
+
+			name := strings.ToLower(value)
+			if name == "*" {
+				current = append(current, fallback)
+			} else if agent != "" && name == agent {
+				current = append(current, matched)
+				found = true
+			}
+			continue
+		}
+
+		inAgents = false
+		for _, rules := range current {
+			rules.add(key, value)
+		}
+	}
+
+	if !found {
+		return fallback
+	}
+
+	return matched
+}
+
+// add : Adds a line of a group to the rules
+func (r *RobotsRules) add(key string, value string) {
+	switch key {
+	case "allow":
+		r.allow = append(r.allow, value)
+	case "disallow":
+		if value != "" {
+			r.disallow = append(r.disallow, value)
+		}
+	case "crawl-delay":
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+			r.CrawlDelay = time.Duration(seconds * float64(time.Second))
+		}
+	}
+}
+
+// Allowed : Reports whether the rules allow fetching the given path. The longest matching rule
+// wins, and Allow wins a tie
+func (r *RobotsRules) Allowed(path string) bool {
+	longestAllow := -1
+	for _, pattern := range r.allow {
+		if len(pattern) > longestAllow && matchRobotsPattern(pattern, path) {
+			longestAllow = len(pattern)
+		}
+	}
+
+	for _, pattern := range r.disallow {
+		if len(pattern) > longestAllow && matchRobotsPattern(pattern, path) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchRobotsPattern : Reports whether a path matches a robots.txt path pattern, where * matches
+// any run of characters and a trailing $ anchors the pattern to the end of the path
+func matchRobotsPattern(pattern string, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	pieces := strings.Split(pattern, "*")
+	if !strings.HasPrefix(path, pieces[0]) {
+		return false
+	}
+
+	rest := path[len(pieces[0]):]
+	for _, piece := range pieces[1:] {
+		index := strings.Index(rest, piece)
+		if index < 0 {
+			return false
+		}
+		rest = rest[index+len(piece):]
+	}
+
+	if !anchored {
+		return true
+	}
+
+	if len(pieces) == 1 {
+		return rest == ""
+	}
+
+	return strings.HasSuffix(path, pieces[len(pieces)-1])
+}
+
+// productToken : Gets the name robots.txt groups are matched against from a User-Agent header
+func productToken(userAgent string) string {
+	fields := strings.Fields(userAgent)
+	if len(fields) == 0 {
+		return ""
+	}
+
+	return strings.ToLower(strings.SplitN(fields[0], "/", 2)[0])
+}
@@ -0,0 +1,114 @@
+package logging
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Logger : interface for leveled logging with alternating key/value arguments after the
+// message. *slog.Logger satisfies it, as do the loggers in this package
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// Level : the severity of a log message
+type Level int
+
+// Log levels, in increasing severity
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+func (l Level) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+// NopLogger : Logger that discards everything, used when no logger is configured
+type NopLogger struct {
+}
+
+// NewNopLogger : Creates a logger that discards everything
+func NewNopLogger() *NopLogger {
+	return &NopLogger{}
+}
+
+// Debug : Discards the message
+func (l *NopLogger) Debug(msg string, args ...interface{}) {}
+
+// Info : Discards the message
+func (l *NopLogger) Info(msg string, args ...interface{}) {}
+
+// Warn : Discards the message
+func (l *NopLogger) Warn(msg string, args ...interface{}) {}
+
+// Error : Discards the message
+func (l *NopLogger) Error(msg string, args ...interface{}) {}
+
+// StdLogger : Logger that writes messages at or above a minimum level to a standard library
+// logger, formatted as "LEVEL msg key=value ..."
+type StdLogger struct {
+	logger *log.Logger
+	level  Level
+}
+
+// NewStdLogger : Creates a logger writing messages at or above the given level to the given logger
+func NewStdLogger(logger *log.Logger, level Level) *StdLogger {
+	return &StdLogger{logger: logger, level: level}
+}
+
+// Debug : Logs a message at debug level
+func (l *StdLogger) Debug(msg string, args ...interface{}) {
+	l.log(LevelDebug, msg, args)
+}
+
+// Info : Logs a message at info level
+func (l *StdLogger) Info(msg string, args ...interface{}) {
+	l.log(LevelInfo, msg, args)
+}
+
+// Warn : Logs a message at warn level
+func (l *StdLogger) Warn(msg string, args ...interface{}) {
+	l.log(LevelWarn, msg, args)
+}
+
+// Error : Logs a message at error level
+func (l *StdLogger) Error(msg string, args ...interface{}) {
+	l.log(LevelError, msg, args)
+}
+
+func (l *StdLogger) log(level Level, msg string, args []interface{}) {
+	if level < l.level {
+		return
+	}
+
+	var builder strings.Builder
+	builder.WriteString(level.String())
+	builder.WriteString(" ")
+	builder.WriteString(msg)
+
+	for index := 0; index < len(args); index += 2 {
+		if index+1 < len(args) {
+			fmt.Fprintf(&builder, " %v=%v", args[index], args[index+1])
+		} else {
+			fmt.Fprintf(&builder, " !BADKEY=%v", args[index])
+		}
+	}
+
+	l.logger.Print(builder.String())
+}
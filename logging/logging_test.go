@@ -0,0 +1,36 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	t.Run("Format key value pairs", func(t *testing.T) {
+		var buffer bytes.Buffer
+		logger := NewStdLogger(log.New(&buffer, "", 0), LevelDebug)
+
+		logger.Warn("fetch failed", "url", "/wiki/Fife", "err", errors.New("timeout"))
+
+		expected := "WARN fetch failed url=/wiki/Fife err=timeout\n"
+		if buffer.String() != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, buffer.String())
+		}
+	})
+
+	t.Run("Drop messages below the level", func(t *testing.T) {
+		var buffer bytes.Buffer
+		logger := NewStdLogger(log.New(&buffer, "", 0), LevelWarn)
+
+		logger.Debug("fetched page", "url", "/wiki/Fife")
+		logger.Info("search finished")
+		logger.Error("query failed", "dangling")
+
+		expected := "ERROR query failed !BADKEY=dangling\n"
+		if buffer.String() != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, buffer.String())
+		}
+	})
+}
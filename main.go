@@ -1,25 +1,9 @@
 package main
 
 import (
-	"WikiGo/crawler"
-	"fmt"
+	"os"
 )
 
 func main() {
-	patterns := []string{"/wiki/"}
-	exclude := []string{"Wikipedia:", "Special:", "Help:", "Books:", "File:", ".jpg"}
-	trimMarkers := []string{">Notes<", ">References<", ">See also<", `#External_links">`, `id="catlinks"`}
-	myCrawler := crawler.NewCrawler("https://en.wikipedia.org/wiki/UK_miners'_strike_(1984%E2%80%9385)",
-		"https://en.wikipedia.org/wiki/Lawrence_Daly",
-		"https://en.wikipedia.org", patterns, exclude, trimMarkers, 3, true)
-
-	path, err := myCrawler.GetShortestPathToArticle()
-
-	if err != nil {
-		fmt.Print(err)
-	}
-
-	if path == nil {
-		fmt.Println("FAILED")
-	}
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
 }
@@ -0,0 +1,81 @@
+package normalize
+
+import (
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// ArticlePath : path prefix under which MediaWiki serves articles
+const ArticlePath = "/wiki/"
+
+// URL : Normalizes the URL of a page so that every way of linking to an article gives the same
+// URL. The fragment and query string are dropped, the scheme and host are lowercased, and the
+// title of an article is normalized with Title and escaped consistently. index.php links with
+// a title parameter are turned into article links. URLs that can't be parsed are returned as is
+func URL(raw string) string {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return raw
+	}
+
+	if strings.HasSuffix(parsed.Path, "/index.php") {
+		if title := parsed.Query().Get("title"); title != "" {
+			parsed.Path = ArticlePath + title
+		}
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	parsed.Fragment = ""
+	parsed.RawQuery = ""
+	parsed.ForceQuery = false
+
+	if index := strings.Index(parsed.Path, ArticlePath); index >= 0 && index+len(ArticlePath) < len(parsed.Path) {
+		title := Title(parsed.Path[index+len(ArticlePath):])
+		parsed.Path = parsed.Path[:index] + ArticlePath + strings.ReplaceAll(title, " ", "_")
+	}
+	parsed.RawPath = ""
+
+	return parsed.String()
+}
+
+// Title : Normalizes the title of an article the way MediaWiki does, so that "foo_bar",
+// " Foo  bar " and "Foo bar" are the same title. Underscores become spaces, runs of whitespace
+// are collapsed, and the first letter is uppercased
+func Title(title string) string {
+	title = strings.Join(strings.Fields(strings.ReplaceAll(title, "_", " ")), " ")
+	first, size := utf8.DecodeRuneInString(title)
+	if first == utf8.RuneError {
+		return title
+	}
+
+	return string(unicode.ToUpper(first)) + title[size:]
+}
+
+// PageName : Gets the MediaWiki page name of the article at the given URL, e.g. "Lawrence_Daly",
+// or an empty string if the URL isn't an article URL
+func PageName(raw string) string {
+	parsed, err := url.Parse(URL(raw))
+	if err != nil {
+		return ""
+	}
+
+	index := strings.Index(parsed.Path, ArticlePath)
+	if index < 0 || index+len(ArticlePath) == len(parsed.Path) {
+		return ""
+	}
+
+	return parsed.Path[index+len(ArticlePath):]
+}
+
+// Host : Gets the lowercased host of the given URL, or an empty string if it is relative
+func Host(raw string) string {
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return ""
+	}
+
+	return strings.ToLower(parsed.Host)
+}
@@ -0,0 +1,76 @@
+package normalize
+
+import (
+	"testing"
+)
+
+func TestURL(t *testing.T) {
+	cases := map[string]string{
+		"https://en.wikipedia.org/wiki/Fife":                          "https://en.wikipedia.org/wiki/Fife",
+		"https://en.wikipedia.org/wiki/Fife#History":                  "https://en.wikipedia.org/wiki/Fife",
+		"https://en.wikipedia.org/wiki/fife?oldid=1":                  "https://en.wikipedia.org/wiki/Fife",
+		"HTTPS://EN.WIKIPEDIA.ORG/wiki/Fife":                          "https://en.wikipedia.org/wiki/Fife",
+		"https://en.wikipedia.org/wiki/Lawrence Daly":                 "https://en.wikipedia.org/wiki/Lawrence_Daly",
+		"https://en.wikipedia.org/wiki/Lawrence%20Daly":               "https://en.wikipedia.org/wiki/Lawrence_Daly",
+		"https://en.wikipedia.org/wiki/%C3%A9cole":                    "https://en.wikipedia.org/wiki/%C3%89cole",
+		"https://en.wikipedia.org/wiki/AC/DC":                         "https://en.wikipedia.org/wiki/AC/DC",
+		"https://en.wikipedia.org/w/index.php?title=Fife&action=view": "https://en.wikipedia.org/wiki/Fife",
+		"/wiki/miners'_strike_(1984%E2%80%9385)":                      "/wiki/Miners%27_strike_%281984%E2%80%9385%29",
+		"./testHTML/page1.html":                                       "./testHTML/page1.html",
+	}
+
+	for raw, expected := range cases {
+		if normalized := URL(raw); normalized != expected {
+			t.Errorf("Expected '%s' for '%s' but got '%s'", expected, raw, normalized)
+		}
+	}
+}
+
+func TestTitle(t *testing.T) {
+	cases := map[string]string{
+		"Fife":             "Fife",
+		"lawrence_Daly":    "Lawrence Daly",
+		"  Lawrence  Daly": "Lawrence Daly",
+		"école":            "École",
+		"":                 "",
+	}
+
+	for title, expected := range cases {
+		if normalized := Title(title); normalized != expected {
+			t.Errorf("Expected '%s' for '%s' but got '%s'", expected, title, normalized)
+		}
+	}
+}
+
+func TestPageName(t *testing.T) {
+	cases := map[string]string{
+		"https://en.wikipedia.org/wiki/Lawrence_Daly":     "Lawrence_Daly",
+		"https://en.wikipedia.org/wiki/lawrence%20Daly":   "Lawrence_Daly",
+		"https://en.wikipedia.org/wiki/AC/DC#Members":     "AC/DC",
+		"https://en.wikipedia.org/wiki/%C3%89cole":        "École",
+		"https://en.wikipedia.org/w/index.php?title=Fife": "Fife",
+		"https://en.wikipedia.org/wiki/":                  "",
+		"./testHTML/page1.html":                           "",
+	}
+
+	for raw, expected := range cases {
+		if name := PageName(raw); name != expected {
+			t.Errorf("Expected '%s' for '%s' but got '%s'", expected, raw, name)
+		}
+	}
+}
+
+func TestHost(t *testing.T) {
+	cases := map[string]string{
+		"https://EN.wikipedia.org/wiki/Fife": "en.wikipedia.org",
+		"https://de.wikipedia.org/wiki/Fife": "de.wikipedia.org",
+		"/wiki/Fife":                         "",
+		"./testHTML/page1.html":              "",
+	}
+
+	for raw, expected := range cases {
+		if host := Host(raw); host != expected {
+			t.Errorf("Expected '%s' for '%s' but got '%s'", expected, raw, host)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package parser
+
+import (
+	"WikiGo/normalize"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// LinkFilter : decides which of the links found in a document a parser keeps. The link has
+// been resolved against base, the URL of the document or its <base href>
+type LinkFilter interface {
+	Allow(link *url.URL, base *url.URL) bool
+}
+
+// Matcher : matches the links a rule of a RuleFilter applies to
+type Matcher interface {
+	Match(link *url.URL, base *url.URL) bool
+}
+
+// MatcherFunc : adapter to use a function as a Matcher
+type MatcherFunc func(link *url.URL, base *url.URL) bool
+
+// Match : Calls the function
+func (f MatcherFunc) Match(link *url.URL, base *url.URL) bool {
+	return f(link, base)
+}
+
+// Action : what a rule does with the links it matches
+type Action int
+
+// Include keeps the links a rule matches, and Exclude drops them
+const (
+	Include Action = iota
+	Exclude
+)
+
+// Rule : a matcher and what to do with the links it matches
+type Rule struct {
+	Action  Action
+	Matcher Matcher
+}
+
+// RuleFilter : LinkFilter that evaluates its rules in order. The first rule that matches a link
+// decides whether it is kept, and links no rule matches get the default action
+type RuleFilter struct {
+	defaultAction Action
+	rules         []Rule
+}
+
+// NewRuleFilter : Creates a new rule filter with the given default action and rules
+func NewRuleFilter(defaultAction Action, rules ...Rule) *RuleFilter {
+	return &RuleFilter{defaultAction: defaultAction, rules: rules}
+}
+
+// Allow : Reports whether the first rule matching the link, or the default, includes it
+func (f *RuleFilter) Allow(link *url.URL, base *url.URL) bool {
+	for _, rule := range f.rules {
+		if rule.Matcher.Match(link, base) {
+			return rule.Action == Include
+		}
+	}
+
+	return f.defaultAction == Include
+}
+
+// PatternFilter : Creates the filter a parser with the given patterns and excludes uses. Links
+// containing any of the excludes are dropped, and if there are patterns only the links matching
+// one of them, as MatchPrefix matches them, are kept
+func PatternFilter(patterns []string, excludes []string) *RuleFilter {
+	rules := make([]Rule, 0, 2)
+	if len(excludes) != 0 {
+		rules = append(rules, Rule{Action: Exclude, Matcher: MatchSubstring(excludes...)})
+	}
+
+	if len(patterns) == 0 {
+		return NewRuleFilter(Include, rules...)
+	}
+
+	rules = append(rules, Rule{Action: Include, Matcher: MatchPrefix(patterns...)})
+	return NewRuleFilter(Exclude, rules...)
+}
+
+// MatchPrefix : Matches links starting with any of the prefixes. Prefixes starting with a slash
+// match the path of links on the same host as the base, and others match the whole link
+func MatchPrefix(prefixes ...string) Matcher {
+	return MatcherFunc(func(link *url.URL, base *url.URL) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(prefix, "/") {
+				if strings.EqualFold(link.Host, base.Host) && strings.HasPrefix(link.Path, prefix) {
+					return true
+				}
+			} else if strings.HasPrefix(link.String(), prefix) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// MatchSubstring : Matches links containing any of the substrings
+func MatchSubstring(subStrs ...string) Matcher {
+	return MatcherFunc(func(link *url.URL, base *url.URL) bool {
+		for _, subStr := range subStrs {
+			if strings.Contains(link.String(), subStr) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// MatchRegexp : Matches links the regular expression matches
+func MatchRegexp(re *regexp.Regexp) Matcher {
+	return MatcherFunc(func(link *url.URL, base *url.URL) bool {
+		return re.MatchString(link.String())
+	})
+}
+
+// MatchGlob : Matches links whose path matches the glob, with the syntax of path.Match, so "*"
+// doesn't match a slash
+func MatchGlob(glob string) (Matcher, error) {
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, err
+	}
+
+	return MatcherFunc(func(link *url.URL, base *url.URL) bool {
+		matched, _ := path.Match(glob, link.Path)
+		return matched
+	}), nil
+}
+
+// MatchExtension : Matches links whose path ends with any of the file extensions, e.g. ".jpg",
+// in any case
+func MatchExtension(extensions ...string) Matcher {
+	return MatcherFunc(func(link *url.URL, base *url.URL) bool {
+		extension := path.Ext(link.Path)
+		for _, candidate := range extensions {
+			if extension != "" && strings.EqualFold(extension, candidate) {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// MatchNamespace : Matches article links whose titles are in any of the MediaWiki namespaces
+// with the given numbers, named as in the given table
+func MatchNamespace(namespaces Namespaces, numbers ...int) Matcher {
+	return MatcherFunc(func(link *url.URL, base *url.URL) bool {
+		name := normalize.PageName(link.String())
+		if name == "" {
+			return false
+		}
+
+		namespace := namespaces.Of(name)
+		for _, number := range numbers {
+			if namespace == number {
+				return true
+			}
+		}
+
+		return false
+	})
+}
+
+// Namespaces : the numbers of the namespaces of a MediaWiki site by name, including localized
+// names and aliases. Names are case insensitive and underscores are spaces
+type Namespaces map[string]int
+
+// DefaultNamespaces : Gets the canonical English names of the namespaces of Wikipedia
+func DefaultNamespaces() Namespaces {
+	namespaces := make(Namespaces)
+	for name, number := range map[string]int{
+		"Media": -2, "Special": -1, "Talk": 1, "User": 2, "User talk": 3, "Project": 4, "Wikipedia": 4,
+		"WP": 4, "Project talk": 5, "Wikipedia talk": 5, "File": 6, "Image": 6, "File talk": 7,
+		"Image talk": 7, "MediaWiki": 8, "MediaWiki talk": 9, "Template": 10, "Template talk": 11,
+		"Help": 12, "Help talk": 13, "Category": 14, "Category talk": 15, "Portal": 100, "Portal talk": 101,
+		"Book": 108, "Book talk": 109, "Draft": 118, "Draft talk": 119, "TimedText": 710,
+		"TimedText talk": 711, "Module": 828, "Module talk": 829,
+	} {
+		namespaces.Add(name, number)
+	}
+
+	return namespaces
+}
+
+// Add : Adds a name of the namespace with the given number
+func (n Namespaces) Add(name string, number int) {
+	n[namespaceName(name)] = number
+}
+
+// Number : Gets the number of the namespace with the given name
+func (n Namespaces) Number(name string) (int, bool) {
+	number, exists := n[namespaceName(name)]
+	return number, exists
+}
+
+// Of : Gets the number of the namespace of the page with the given name, 0 for articles. Only the
+// text before the first colon is a namespace, and only if it names one, so "Film: The Movie" is
+// an article
+func (n Namespaces) Of(pageName string) int {
+	index := strings.Index(pageName, ":")
+	if index < 0 {
+		return 0
+	}
+
+	if number, exists := n.Number(pageName[:index]); exists {
+		return number
+	}
+
+	return 0
+}
+
+func namespaceName(name string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(name, "_", " ")), " "))
+}
+
+// filterConfig : a RuleFilter as read from a file
+type filterConfig struct {
+	Default    string         `json:"default"`
+	Namespaces map[string]int `json:"namespaces"`
+	Rules      []ruleConfig   `json:"rules"`
+}
+
+// ruleConfig : a rule as read from a file, with exactly one kind of matcher
+type ruleConfig struct {
+	Action    string        `json:"action"`
+	Prefix    []string      `json:"prefix"`
+	Contains  []string      `json:"contains"`
+	Regex     string        `json:"regex"`
+	Glob      string        `json:"glob"`
+	Extension []string      `json:"extension"`
+	Namespace []interface{} `json:"namespace"`
+}
+
+// LoadLinkFilter : Reads a rule filter from the JSON file at the given path, as ParseLinkFilter does
+func LoadLinkFilter(path string) (*RuleFilter, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseLinkFilter(data)
+}
+
+// ParseLinkFilter : Parses a rule filter from JSON such as
+//
+//	{
+//		"default": "exclude",
+//		"namespaces": {"Datei": 6},
+//		"rules": [
+//			{"action": "exclude", "namespace": ["Special", "Datei", 4]},
+//			{"action": "exclude", "extension": [".jpg", ".svg"]},
+//			{"action": "include", "prefix": ["/wiki/"]}
+//		]
+//	}
+//
+// Rules have an action, include or exclude, and one of prefix, contains, regex, glob, extension
+// or namespace. Namespaces are given by number or by name, from DefaultNamespaces and the
+// namespaces of the file. The default action is include if it isn't given
+func ParseLinkFilter(data []byte) (*RuleFilter, error) {
+	var config filterConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	defaultAction, err := parseAction(config.Default, Include)
+	if err != nil {
+		return nil, err
+	}
+
+	namespaces := DefaultNamespaces()
+	for name, number := range config.Namespaces {
+		namespaces.Add(name, number)
+	}
+
+	rules := make([]Rule, 0, len(config.Rules))
+	for index, ruleConf := range config.Rules {
+		rule, err := ruleConf.rule(namespaces)
+		if err != nil {
+			return nil, fmt.Errorf("rule %d: %w", index+1, err)
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return NewRuleFilter(defaultAction, rules...), nil
+}
+
+// rule : Builds the rule described by the config
+func (r ruleConfig) rule(namespaces Namespaces) (Rule, error) {
+	action, err := parseAction(r.Action, -1)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	matchers := make([]Matcher, 0, 1)
+	if len(r.Prefix) != 0 {
+		matchers = append(matchers, MatchPrefix(r.Prefix...))
+	}
+
+	if len(r.Contains) != 0 {
+		matchers = append(matchers, MatchSubstring(r.Contains...))
+	}
+
+	if r.Regex != "" {
+		re, err := regexp.Compile(r.Regex)
+		if err != nil {
+			return Rule{}, err
+		}
+		matchers = append(matchers, MatchRegexp(re))
+	}
+
+	if r.Glob != "" {
+		matcher, err := MatchGlob(r.Glob)
+		if err != nil {
+			return Rule{}, err
+		}
+		matchers = append(matchers, matcher)
+	}
+
+	if len(r.Extension) != 0 {
+		matchers = append(matchers, MatchExtension(r.Extension...))
+	}
+
+	if len(r.Namespace) != 0 {
+		numbers := make([]int, 0, len(r.Namespace))
+		for _, namespace := range r.Namespace {
+			switch value := namespace.(type) {
+			case float64:
+				numbers = append(numbers, int(value))
+			case string:
+				number, exists := namespaces.Number(value)
+				if !exists {
+					return Rule{}, fmt.Errorf("unknown namespace %q", value)
+				}
+				numbers = append(numbers, number)
+			default:
+				return Rule{}, fmt.Errorf("namespace %v is neither a number nor a name", namespace)
+			}
+		}
+		matchers = append(matchers, MatchNamespace(namespaces, numbers...))
+	}
+
+	if len(matchers) != 1 {
+		return Rule{}, fmt.Errorf("a rule needs exactly one matcher but has %d", len(matchers))
+	}
+
+	return Rule{Action: action, Matcher: matchers[0]}, nil
+}
+
+// parseAction : Parses include or exclude, giving the fallback for an empty action if it is valid
+func parseAction(action string, fallback Action) (Action, error) {
+	switch strings.ToLower(action) {
+	case "include":
+		return Include, nil
+	case "exclude":
+		return Exclude, nil
+	case "":
+		if fallback == Include || fallback == Exclude {
+			return fallback, nil
+		}
+	}
+
+	return 0, fmt.Errorf("action must be include or exclude, not %q", action)
+}
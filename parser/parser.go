@@ -1,159 +1,242 @@
 package parser
 
 import (
-	"bytes"
-	"golang.org/x/net/html"
+	"WikiGo/wikipage"
+	"io"
+	"regexp"
 	"strings"
 )
 
+// pageNamePattern : matches the wgPageName value of the configuration MediaWiki embeds in a script
+var pageNamePattern = regexp.MustCompile(`"wgPageName"\s*:\s*("(?:[^"\\]|\\.)*")`)
+
+// displayTitlePattern : matches the wgTitle value of the configuration MediaWiki embeds in a script
+var displayTitlePattern = regexp.MustCompile(`"wgTitle"\s*:\s*("(?:[^"\\]|\\.)*")`)
+
+// firstHeadingID : id of the <h1> MediaWiki shows the title of the page in
+const firstHeadingID = "firstHeading"
+
 // Parser : struct that takes parses HTML documents, using a domain to find links for,
 //          patterns to look for, links to exclude, and a trim marker to crop HTML at
 type Parser struct {
-	domain      string
-	pattern     []string
-	exclude     []string
-	trimMarkers []string
+	domain         string
+	filter         LinkFilter
+	scope          *ContentScope
+	keepDuplicates bool
+	mode           LinkMode
+	trimMarkers    []string
 }
 
-// NewParser : Creates a new parser object with the given parameters
-func NewParser(domain string, pattern []string, exclude []string, trimMarkers []string) *Parser {
-	p := Parser{domain: domain, pattern: pattern, exclude: exclude, trimMarkers: trimMarkers}
+// LinkMode : which of the links in the content scope of a document a parser finds
+type LinkMode int
+
+// Link modes : every link, the links of the lead section, or the first link outside parentheses and tables
+const (
+	AllLinks LinkMode = iota
+	LeadLinks
+	FirstLink
+)
+
+// Option : configures a Parser created with NewParser
+type Option func(*Parser)
+
+// NewParser : Creates a new parser object with the given parameters. The patterns and excludes
+// make up the link filter, as PatternFilter, unless one is given with WithLinkFilter
+func NewParser(domain string, pattern []string, exclude []string, trimMarkers []string, opts ...Option) *Parser {
+	p := Parser{domain: domain, filter: PatternFilter(pattern, exclude), trimMarkers: trimMarkers}
+	for _, opt := range opts {
+		opt(&p)
+	}
+
 	return &p
 }
 
-// GetLinks : Parse all links from the HTML document
-func (p *Parser) GetLinks(htm string) ([]string, error) {
-	cleanedHtm := strings.NewReader(p.trimDocument(htm))
-	htmlTree, err := html.Parse(cleanedHtm)
-	links := make(map[string]bool)
+// WithLinkFilter : Sets the filter that decides which links are kept, in place of the patterns
+// and excludes
+func WithLinkFilter(filter LinkFilter) Option {
+	return func(p *Parser) {
+		p.filter = filter
+	}
+}
 
-	if err != nil {
-		return nil, err
+// WithContentScope : Restricts the links the parser finds to the given part of each document
+func WithContentScope(scope *ContentScope) Option {
+	return func(p *Parser) {
+		p.scope = scope
 	}
+}
 
-	var crawl func(node *html.Node)
-	crawl = func(node *html.Node) {
-		if node.Type == html.ElementNode && node.Data == "a" {
-			attributes := node.Attr
-			for _, attr := range attributes {
-				if attr.Key == "href" {
-					links[attr.Val] = true
-				}
-			}
-		}
-
-		for child := node.FirstChild; child != nil; child = child.NextSibling {
-			crawl(child)
-		}
+// WithKeepDuplicates : Sets whether a link that appears more than once in a document is found
+// every time it appears, with the context of each anchor, instead of only the first time
+func WithKeepDuplicates(keepDuplicates bool) Option {
+	return func(p *Parser) {
+		p.keepDuplicates = keepDuplicates
 	}
+}
 
-	crawl(htmlTree)
+// WithLinkMode : Sets which of the links in the content scope the parser finds. Documents are only
+// read as far as the mode needs
+func WithLinkMode(mode LinkMode) Option {
+	return func(p *Parser) {
+		p.mode = mode
+	}
+}
 
-	keys := make([]string, 0, len(links))
-	for key := range links {
-		keys = append(keys, key)
+// With : Creates a copy of the parser with the given options applied on top of its own
+func (p *Parser) With(opts ...Option) *Parser {
+	copied := *p
+	for _, opt := range opts {
+		opt(&copied)
 	}
 
-	keys = p.prependDomainToLinks(p.removeExcludedLinks(p.filterPatternLinks(keys)))
-	return keys, nil
+	return &copied
 }
 
-// ExtractDocumentTitle : Extracts document title from HTML string
-func (p *Parser) ExtractDocumentTitle(htm string) (string, error) {
-	htmStream := strings.NewReader(p.trimDocument(htm))
-	startNode, err := html.Parse(htmStream)
-	title := ""
-
-	if err != nil {
-		return "", err
-	}
+// Domain : Gets the domain the parser resolves relative links against
+func (p *Parser) Domain() string {
+	return p.domain
+}
 
-	var crawl func(node *html.Node)
-	crawl = func(node *html.Node) {
-		if node.Type == html.ElementNode && node.Data == "title" {
-			title = node.FirstChild.Data
-		}
+// LinkMode : Gets which of the links in the content scope the parser finds
+func (p *Parser) LinkMode() LinkMode {
+	return p.mode
+}
 
-		for child := node.FirstChild; child != nil; child = child.NextSibling {
-			crawl(child)
-		}
+// allows : Reports whether the parser's link mode finds the link, given how many links it has
+// found in the document already
+func (p *Parser) allows(link Link, found int) bool {
+	switch p.mode {
+	case LeadLinks:
+		return link.InLead
+	case FirstLink:
+		return found == 0 && !link.InParentheses && !link.InItalics && !link.InTable && !link.InInfobox
+	default:
+		return true
 	}
+}
 
-	crawl(startNode)
-	return title, nil
+// Link : a link found in an HTML document, with the text of its anchor and where the anchor is
+type Link struct {
+	URL  string
+	Text string
+	// Section is the text of the heading of the section the link is in, empty in the lead
+	Section string
+	// Paragraph is the number, from 1, of the paragraph of the content the link is in, or 0 if it
+	// isn't in a paragraph
+	Paragraph int
+	// Position is the number, from 1, of the link among the links of the content, counting every
+	// appearance of a link even if only the first is found
+	Position int
+	// InLead reports whether the link comes before the first section heading
+	InLead    bool
+	InInfobox bool
+	InTable   bool
+	InList    bool
+	InItalics bool
+	// InParentheses reports whether the link is inside parentheses opened earlier in its
+	// paragraph or list item
+	InParentheses bool
 }
 
-func (p *Parser) filterPatternLinks(links []string) []string {
-	if p.pattern == nil || len(p.pattern) == 0 {
-		return links
-	}
+// ParsedPage : the display title, canonical URL, key and links of an HTML document, found in one parse
+type ParsedPage struct {
+	Title        string
+	CanonicalURL string
+	Key          wikipage.PageKey
+	Links        []Link
+}
 
-	resultLinks := make([]string, 0)
+// Parse : Parses the HTML document once, up to the first trim marker, extracting its metadata and links
+func (p *Parser) Parse(htm string) (*ParsedPage, error) {
+	return p.ParseReader(strings.NewReader(htm))
+}
 
-	for _, link := range links {
-		for _, pattern := range p.pattern {
-			if strings.HasPrefix(link, pattern) {
-				resultLinks = append(resultLinks, link)
-				break
-			}
-		}
+// ParseReader : Parses the HTML document read from r like Parse, tokenizing it as it is read
+func (p *Parser) ParseReader(r io.Reader) (*ParsedPage, error) {
+	return p.ParseReaderWithBase(r, "")
+}
+
+// ParseReaderWithBase : Parses the document at the given URL like ParseReader, resolving links against it
+func (p *Parser) ParseReaderWithBase(r io.Reader, documentURL string) (*ParsedPage, error) {
+	page := ParsedPage{Links: make([]Link, 0)}
+	err := p.stream(r, documentURL, p.scope, true, &page, func(link Link) error {
+		page.Links = append(page.Links, link)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return resultLinks
+	return &page, nil
 }
 
-func (p *Parser) removeExcludedLinks(links []string) []string {
-	if p.exclude == nil || len(p.exclude) == 0 {
-		return links
-	}
+// StreamLinks : Calls visit with each link of the document read from r, stopping at the first error
+func (p *Parser) StreamLinks(r io.Reader, visit func(Link) error) error {
+	return p.stream(r, "", p.scope, true, &ParsedPage{}, visit)
+}
 
-	results := make([]string, 0)
-	for _, link := range links {
-		shouldInclude := true
+// GetLinks : Parse all links from the HTML document
+func (p *Parser) GetLinks(htm string) ([]string, error) {
+	return p.getLinks(htm, p.scope, true)
+}
 
-		for _, subStr := range p.exclude {
-			if strings.Contains(link, subStr) {
-				shouldInclude = false
-				break
-			}
-		}
+// GetLinksInElement : Parse all links inside the element with the given id from the HTML document,
+// regardless of the parser's content scope
+func (p *Parser) GetLinksInElement(htm string, id string) ([]string, error) {
+	return p.getLinks(htm, idScope(id), false)
+}
 
-		if shouldInclude {
-			results = append(results, link)
-		}
+func (p *Parser) getLinks(htm string, scope *ContentScope, fallback bool) ([]string, error) {
+	urls := make([]string, 0)
+	err := p.stream(strings.NewReader(htm), "", scope, fallback, &ParsedPage{}, func(link Link) error {
+		urls = append(urls, link.URL)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	return results
+	return urls, nil
 }
 
-func (p *Parser) prependDomainToLinks(links []string) []string {
-	if p.domain == "" {
-		return links
+// ExtractLinks : Parse all links from the HTML document with their anchor text, in document order
+func (p *Parser) ExtractLinks(htm string) ([]Link, error) {
+	page, err := p.Parse(htm)
+	if err != nil {
+		return nil, err
 	}
 
-	newLinks := make([]string, 0)
-	for _, link := range links {
-		var buffer bytes.Buffer
-		buffer.WriteString(p.domain)
-		buffer.WriteString(link)
-		newLinks = append(newLinks, buffer.String())
+	return page.Links, nil
+}
+
+// ExtractDocumentTitle : Extracts the title of the HTML document, as ParsedPage has it
+func (p *Parser) ExtractDocumentTitle(htm string) (string, error) {
+	page, err := p.Parse(htm)
+	if err != nil {
+		return "", err
 	}
 
-	return newLinks
+	return page.Title, nil
 }
 
-func (p *Parser) trimDocument(htm string) string {
-	if p.trimMarkers == nil || len(p.trimMarkers) == 0 {
-		return htm
+// ExtractCanonicalURL : Extracts the normalized URL of the <link rel="canonical"> of the HTML document
+func (p *Parser) ExtractCanonicalURL(htm string) (string, error) {
+	page, err := p.Parse(htm)
+	if err != nil {
+		return "", err
 	}
 
-	parts := htm
+	return page.CanonicalURL, nil
+}
 
-	for _, marker := range p.trimMarkers {
-		parts = strings.Split(htm, marker)[0]
+// ExtractPageKey : Extracts the key of the page from its wgPageName or canonical URL, empty without either
+func (p *Parser) ExtractPageKey(htm string) (wikipage.PageKey, error) {
+	page, err := p.Parse(htm)
+	if err != nil {
+		return "", err
 	}
 
-	return parts
+	return page.Key, nil
 }
 
 func sanitizeLink(link string) string {
@@ -1,8 +1,17 @@
 package parser
 
 import (
+	"WikiGo/wikipage"
+	"errors"
+	"golang.org/x/net/html"
+	"io"
 	"io/ioutil"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func assertSameSlice(t *testing.T, result, expected []string) {
@@ -28,7 +37,7 @@ func assertSameSlice(t *testing.T, result, expected []string) {
 
 func TestGetLinks(t *testing.T) {
 	t.Run("Using an empty body", func(t *testing.T) {
-		p := NewParser("", []string{}, []string{}, "")
+		p := NewParser("", []string{}, []string{}, nil)
 
 		result, err := p.GetLinks("")
 
@@ -42,7 +51,7 @@ func TestGetLinks(t *testing.T) {
 	})
 
 	t.Run("Body with no links", func(t *testing.T) {
-		p := NewParser("", []string{}, []string{}, "")
+		p := NewParser("", []string{}, []string{}, nil)
 
 		testBody := `<html>
 <head>
@@ -65,7 +74,7 @@ func TestGetLinks(t *testing.T) {
 	})
 
 	t.Run("Finding a single link", func(t *testing.T) {
-		p := NewParser("", []string{}, []string{}, "")
+		p := NewParser("", []string{}, []string{}, nil)
 		testBody := `<html>
 <head>
 <title>Test website</title>
@@ -88,7 +97,7 @@ func TestGetLinks(t *testing.T) {
 	})
 
 	t.Run("Finding multiple links", func(t *testing.T) {
-		p := NewParser("", []string{}, []string{}, "")
+		p := NewParser("", []string{}, []string{}, nil)
 		testBody := `<html>
 <head>
 <title>Test website</title>
@@ -112,7 +121,7 @@ func TestGetLinks(t *testing.T) {
 	})
 
 	t.Run("Don't add duplicates", func(t *testing.T) {
-		p := NewParser("", []string{}, []string{}, "")
+		p := NewParser("", []string{}, []string{}, nil)
 		testBody := `<html>
 <head>
 <title>Test website</title>
@@ -138,7 +147,7 @@ func TestGetLinks(t *testing.T) {
 	})
 
 	t.Run("Finding nested links", func(t *testing.T) {
-		p := NewParser("", []string{}, []string{}, "")
+		p := NewParser("", []string{}, []string{}, nil)
 		body, _ := ioutil.ReadFile("test.html")
 		htm := string(body)
 		result, err := p.GetLinks(htm)
@@ -152,7 +161,7 @@ func TestGetLinks(t *testing.T) {
 	})
 
 	t.Run("Find links after trim", func(t *testing.T) {
-		p := NewParser("", []string{}, []string{}, "<ul>")
+		p := NewParser("", []string{}, []string{}, []string{"<ul>"})
 		body, _ := ioutil.ReadFile("test.html")
 		htm := string(body)
 		result, err := p.GetLinks(htm)
@@ -164,11 +173,225 @@ func TestGetLinks(t *testing.T) {
 		expected := []string{"http://www.yahoo.com/"}
 		assertSameSlice(t, result, expected)
 	})
+
+	t.Run("Trim at the earliest of several markers", func(t *testing.T) {
+		p := NewParser("", []string{}, []string{}, []string{"Here's a", "<ul>"})
+		body, _ := ioutil.ReadFile("test.html")
+		result, err := p.GetLinks(string(body))
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		assertSameSlice(t, result, []string{})
+	})
+}
+
+func TestExtractLinks(t *testing.T) {
+	t.Run("Keep anchor text in document order", func(t *testing.T) {
+		p := NewParser("https://en.wikipedia.org", []string{"/wiki/"}, []string{"File:"}, nil)
+		testBody := `<html>
+<head>
+<title>Test website</title>
+</head>
+<body>
+<p>The <a href="/wiki/Miners_strike">miners'
+  <b>strike</b></a> was led by <a href="/wiki/Arthur_Scargill">Arthur Scargill</a>.</p>
+<p><a href="/wiki/File:Strike.jpg">A picture</a> of <a href="/wiki/Miners_strike">the strike</a></p>
+</body>
+</html>`
+
+		result, err := p.ExtractLinks(testBody)
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		expected := []Link{
+			Link{URL: "https://en.wikipedia.org/wiki/Miners_strike", Text: "miners' strike", Paragraph: 1, Position: 1, InLead: true},
+			Link{URL: "https://en.wikipedia.org/wiki/Arthur_Scargill", Text: "Arthur Scargill", Paragraph: 1, Position: 2, InLead: true},
+		}
+
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%v' but got '%v'", expected, result)
+		}
+	})
+}
+
+func TestNormalizedLinks(t *testing.T) {
+	t.Run("Links to the same article are one link", func(t *testing.T) {
+		p := NewParser("https://en.wikipedia.org", []string{"/wiki/"}, nil, nil)
+		testBody := `<html><body>
+<a href="/wiki/Lawrence_Daly">Daly</a>
+<a href="/wiki/Lawrence_Daly#Early_life">his early life</a>
+<a href="/wiki/lawrence%20Daly">Lawrence Daly</a>
+<a href="/wiki/Fife?action=view">Fife</a>
+</body></html>`
+
+		result, err := p.ExtractLinks(testBody)
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		expected := []Link{
+			Link{URL: "https://en.wikipedia.org/wiki/Lawrence_Daly", Text: "Daly", Position: 1, InLead: true},
+			Link{URL: "https://en.wikipedia.org/wiki/Fife", Text: "Fife", Position: 4, InLead: true},
+		}
+
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%v' but got '%v'", expected, result)
+		}
+	})
+}
+
+func TestParse(t *testing.T) {
+	p := NewParser("https://en.wikipedia.org", []string{"/wiki/"}, nil, nil)
+
+	t.Run("Find everything in one parse", func(t *testing.T) {
+		result, err := p.Parse(`<html><head><title>Lawrence Daly - Wikipedia</title>
+<script>RLCONF={"wgPageName":"Lawrence_Daly"};</script>
+<link rel="canonical" href="/wiki/Lawrence_Daly"></head>
+<body><a href="/wiki/Fife">Fife</a><svg><title>Map</title></svg><a href="/wiki/NUM#History">the union</a></body></html>`)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := &ParsedPage{
+			Title:        "Lawrence Daly - Wikipedia",
+			CanonicalURL: "https://en.wikipedia.org/wiki/Lawrence_Daly",
+			Key:          "en.wikipedia.org/Lawrence_Daly",
+			Links: []Link{
+				Link{URL: "https://en.wikipedia.org/wiki/Fife", Text: "Fife", Position: 1, InLead: true},
+				Link{URL: "https://en.wikipedia.org/wiki/NUM", Text: "the union", Position: 2, InLead: true},
+			},
+		}
+
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%+v' but got '%+v'", expected, result)
+		}
+	})
+
+	t.Run("Use the display title of MediaWiki pages", func(t *testing.T) {
+		result, err := p.Parse(`<html><head><title>Lawrence Daly - Wikipedia</title>
+<script>RLCONF={"wgPageName":"Lawrence_Daly","wgTitle":"Lawrence Daly"};</script></head>
+<body><h1 id="firstHeading">Daly</h1></body></html>`)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := "Lawrence Daly"; result.Title != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, result.Title)
+		}
+
+		result, err = p.Parse(`<html><head><title>Lawrence Daly - Wikipedia</title></head>
+<body><h1 id="firstHeading" class="firstHeading"><span class="mw-page-title-main">Lawrence
+Daly</span></h1><p><a href="/wiki/Fife">Fife</a></p></body></html>`)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := "Lawrence Daly"; result.Title != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, result.Title)
+		}
+	})
+
+	t.Run("Page without metadata", func(t *testing.T) {
+		result, err := p.Parse(`<html><body><a href="/wiki/Fife">Fife</a></body></html>`)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if result.Title != "" || result.CanonicalURL != "" || result.Key != "" || len(result.Links) != 1 {
+			t.Errorf("Expected only a link but got '%+v'", result)
+		}
+	})
+}
+
+func TestExtractCanonicalURL(t *testing.T) {
+	p := NewParser("https://en.wikipedia.org", []string{"/wiki/"}, nil, nil)
+
+	t.Run("Find the canonical URL", func(t *testing.T) {
+		result, err := p.ExtractCanonicalURL(`<html><head><title>United Kingdom</title>
+<link rel="canonical" href="https://en.wikipedia.org/wiki/United_Kingdom"></head><body></body></html>`)
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		if expected := "https://en.wikipedia.org/wiki/United_Kingdom"; result != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("Prepend the domain to a relative canonical URL", func(t *testing.T) {
+		result, err := p.ExtractCanonicalURL(`<html><head><link rel="canonical" href="/wiki/United_Kingdom"></head></html>`)
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		if expected := "https://en.wikipedia.org/wiki/United_Kingdom"; result != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("No canonical URL", func(t *testing.T) {
+		result, err := p.ExtractCanonicalURL(`<html><head><title>Fife</title></head></html>`)
+
+		if err != nil || result != "" {
+			t.Errorf("Expected no canonical URL but got '%q', '%v'", result, err)
+		}
+	})
+}
+
+func TestGetLinksInElement(t *testing.T) {
+	t.Run("Only find links inside the element", func(t *testing.T) {
+		p := NewParser("", []string{}, []string{}, nil)
+		testBody := `<html>
+<head>
+<title>Test website</title>
+</head>
+<body>
+<p>Here's a <a href=http://www.yahoo.com/>Link!</a></p>
+<ul id="mw-whatlinkshere-list">
+<li><a href=http://www.google.com/>Link!</a></li>
+<li><a href=http://www.apple.com/>Link!</a></li>
+</ul>
+</body>
+</html>`
+
+		result, err := p.GetLinksInElement(testBody, "mw-whatlinkshere-list")
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		expected := []string{"http://www.google.com/", "http://www.apple.com/"}
+
+		assertSameSlice(t, result, expected)
+	})
+
+	t.Run("Missing element has no links", func(t *testing.T) {
+		p := NewParser("", []string{}, []string{}, nil)
+		body, _ := ioutil.ReadFile("test.html")
+		result, err := p.GetLinksInElement(string(body), "mw-whatlinkshere-list")
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		assertSameSlice(t, result, []string{})
+	})
 }
 
 func TestExtractDocumentTitle(t *testing.T) {
 	t.Run("Find title of document", func(t *testing.T) {
-		p := NewParser("", []string{}, []string{}, "")
+		p := NewParser("", []string{}, []string{}, nil)
 		body, _ := ioutil.ReadFile("test.html")
 		htm := string(body)
 		result, err := p.ExtractDocumentTitle(htm)
@@ -183,3 +406,533 @@ func TestExtractDocumentTitle(t *testing.T) {
 		}
 	})
 }
+
+func TestExtractPageKey(t *testing.T) {
+	p := NewParser("https://en.wikipedia.org", []string{"/wiki/"}, nil, nil)
+
+	t.Run("Use the page name MediaWiki embeds", func(t *testing.T) {
+		result, err := p.ExtractPageKey(`<html><head><title>Lawrence Daly - Wikipedia</title>
+<script>RLCONF={"wgCanonicalNamespace":"","wgPageName":"Lawrence_Daly","wgArticleId":1842730};</script>
+<link rel="canonical" href="https://en.wikipedia.org/wiki/Lawrence_Daly_(trade_unionist)"></head></html>`)
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		if expected := wikipage.PageKey("en.wikipedia.org/Lawrence_Daly"); result != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("Unescape the page name", func(t *testing.T) {
+		result, _ := p.ExtractPageKey(`<html><head><script>RLCONF={"wgPageName":"École_\"Normale\"/Paris"};</script></head></html>`)
+
+		if expected := wikipage.PageKey(`en.wikipedia.org/École_"Normale"/Paris`); result != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("Fall back to the canonical URL", func(t *testing.T) {
+		result, _ := p.ExtractPageKey(`<html><head><title>Fife – Wikipédia</title>
+<link rel="canonical" href="/wiki/Fife"></head></html>`)
+
+		if expected := wikipage.PageKey("en.wikipedia.org/Fife"); result != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("Key pages of the same name on other wikis apart", func(t *testing.T) {
+		de := NewParser("https://de.wikipedia.org", []string{"/wiki/"}, nil, nil)
+		result, _ := de.ExtractPageKey(`<html><head><script>RLCONF={"wgPageName":"Fife"};</script></head></html>`)
+
+		if expected := wikipage.PageKey("de.wikipedia.org/Fife"); result != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("No key", func(t *testing.T) {
+		result, err := p.ExtractPageKey(`<html><head><title>Fife</title></head></html>`)
+
+		if err != nil || result != "" {
+			t.Errorf("Expected no key but got '%q', '%v'", result, err)
+		}
+	})
+}
+
+// failingReader : A reader that fails the test if it is read
+type failingReader struct {
+	t *testing.T
+}
+
+func (r failingReader) Read(b []byte) (int, error) {
+	r.t.Error("Expected nothing after the trim marker to be read")
+	return 0, io.EOF
+}
+
+func TestTrimReader(t *testing.T) {
+	t.Run("Stop at a marker split across reads", func(t *testing.T) {
+		r := newTrimReader(iotest.OneByteReader(strings.NewReader("<p>keep</p><h2 id=\"See_also\">drop")),
+			[]string{`id="References"`, `id="See_also"`})
+
+		result, err := ioutil.ReadAll(r)
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		if expected := "<p>keep</p><h2 "; string(result) != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("Don't read past the marker", func(t *testing.T) {
+		r := newTrimReader(io.MultiReader(strings.NewReader("<p>keep</p><hr>"), failingReader{t}), []string{"<hr>"})
+
+		result, _ := ioutil.ReadAll(r)
+
+		if expected := "<p>keep</p>"; string(result) != expected {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("Read everything without a marker", func(t *testing.T) {
+		r := newTrimReader(iotest.HalfReader(strings.NewReader("<p>keep</p><hr")), []string{"<hr>"})
+
+		result, err := ioutil.ReadAll(r)
+
+		if err != nil || string(result) != "<p>keep</p><hr" {
+			t.Errorf("Expected the whole document but got '%q', '%v'", result, err)
+		}
+	})
+}
+
+func TestStreamLinks(t *testing.T) {
+	p := NewParser("https://en.wikipedia.org", []string{"/wiki/"}, nil, nil)
+	htm := `<html><body><p><a href="/wiki/Fife">Fife</a> and <a href="/wiki/Fife#Towns">its towns</a>
+<a href="/wiki/Kirkcaldy">Kirkcaldy</a><a href="/wiki/Dunfermline">Dunfermline</a></p></body></html>`
+
+	t.Run("Emit each link once", func(t *testing.T) {
+		result := make([]Link, 0)
+		err := p.StreamLinks(strings.NewReader(htm), func(link Link) error {
+			result = append(result, link)
+			return nil
+		})
+
+		if err != nil {
+			t.Error(err)
+		}
+
+		expected := []Link{
+			Link{URL: "https://en.wikipedia.org/wiki/Fife", Text: "Fife", Paragraph: 1, Position: 1, InLead: true},
+			Link{URL: "https://en.wikipedia.org/wiki/Kirkcaldy", Text: "Kirkcaldy", Paragraph: 1, Position: 3, InLead: true},
+			Link{URL: "https://en.wikipedia.org/wiki/Dunfermline", Text: "Dunfermline", Paragraph: 1, Position: 4, InLead: true},
+		}
+
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%v' but got '%v'", expected, result)
+		}
+	})
+
+	t.Run("Stop when the visitor fails", func(t *testing.T) {
+		stop := errors.New("stop")
+		count := 0
+		err := p.StreamLinks(strings.NewReader(htm), func(link Link) error {
+			count++
+			if count == 2 {
+				return stop
+			}
+			return nil
+		})
+
+		if err != stop || count != 2 {
+			t.Errorf("Expected to stop after 2 links with '%v' but got %d links and '%v'", stop, count, err)
+		}
+	})
+}
+
+func TestResolveLinks(t *testing.T) {
+	extract := func(t *testing.T, p *Parser, documentURL string, body string) []string {
+		t.Helper()
+
+		page, err := p.ParseReaderWithBase(strings.NewReader(body), documentURL)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		urls := make([]string, 0, len(page.Links))
+		for _, link := range page.Links {
+			urls = append(urls, link.URL)
+		}
+
+		return urls
+	}
+
+	t.Run("Resolve absolute, protocol-relative and relative links", func(t *testing.T) {
+		p := NewParser("https://en.wikipedia.org", []string{"/wiki/"}, []string{"Special:"}, nil)
+		result := extract(t, p, "https://en.wikipedia.org/wiki/Fife", `<html><body>
+<a href="https://en.wikipedia.org/wiki/Kirkcaldy">Kirkcaldy</a>
+<a href="//en.wikipedia.org/wiki/Dunfermline">Dunfermline</a>
+<a href="St_Andrews">St Andrews</a>
+<a href="https://de.wikipedia.org/wiki/Fife">Fife auf Deutsch</a>
+<a href="/wiki/Special:Random">random</a>
+<a href="#History">history</a>
+<a href="mailto:someone@example.com">mail</a>
+</body></html>`)
+
+		expected := []string{
+			"https://en.wikipedia.org/wiki/Kirkcaldy",
+			"https://en.wikipedia.org/wiki/Dunfermline",
+			"https://en.wikipedia.org/wiki/St_Andrews",
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("Respect the base element", func(t *testing.T) {
+		p := NewParser("https://en.wikipedia.org", []string{"/wiki/"}, nil, nil)
+		result := extract(t, p, "https://en.wikipedia.org/w/index.php?title=Fife",
+			`<html><head><base href="https://en.m.wikipedia.org/wiki/"></head>
+<body><a href="Kirkcaldy">Kirkcaldy</a><a href="https://en.wikipedia.org/wiki/Fife">Fife</a></body></html>`)
+
+		expected := []string{"https://en.m.wikipedia.org/wiki/Kirkcaldy"}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	t.Run("Resolve local files relative to the document", func(t *testing.T) {
+		p := NewParser("", nil, nil, nil)
+		result := extract(t, p, "./testHTML/page1.html",
+			`<html><body><a href="./page2.html">2</a><a href="../other/page3.html">3</a><a href="/abs/page4.html">4</a></body></html>`)
+
+		expected := []string{"./testHTML/page2.html", "./other/page3.html", "/abs/page4.html"}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+}
+
+func TestRuleFilter(t *testing.T) {
+	base, _ := url.Parse("https://en.wikipedia.org/wiki/Fife")
+	allowed := func(filter LinkFilter, link string) bool {
+		parsed, _ := url.Parse(link)
+		return filter.Allow(parsed, base)
+	}
+
+	t.Run("Patterns and excludes", func(t *testing.T) {
+		filter := PatternFilter([]string{"/wiki/"}, []string{"Special:"})
+		cases := map[string]bool{
+			"https://en.wikipedia.org/wiki/Kirkcaldy":          true,
+			"https://en.wikipedia.org/wiki/Special:Random":     false,
+			"https://en.wikipedia.org/w/index.php":             false,
+			"https://de.wikipedia.org/wiki/Kirkcaldy":          false,
+			"https://en.wikipedia.org/wiki/Special_Branch":     true,
+			"https://en.wikipedia.org/wiki/File:Fife.jpg":      true,
+			"https://en.wikipedia.org/wiki/Help:Contents":      true,
+			"https://en.wikipedia.org/wiki/Talk:Kirkcaldy":     true,
+			"https://en.wikipedia.org/wiki/Mining_in_Scotland": true,
+		}
+
+		for link, expected := range cases {
+			if allowed(filter, link) != expected {
+				t.Errorf("Expected '%s' to be allowed: %v", link, expected)
+			}
+		}
+	})
+
+	t.Run("The first matching rule decides", func(t *testing.T) {
+		glob, err := MatchGlob("/wiki/*_(novel)")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		filter := NewRuleFilter(Exclude,
+			Rule{Action: Include, Matcher: glob},
+			Rule{Action: Exclude, Matcher: MatchNamespace(DefaultNamespaces(), 6, 14)},
+			Rule{Action: Exclude, Matcher: MatchExtension(".svg")},
+			Rule{Action: Exclude, Matcher: MatchRegexp(regexp.MustCompile(`/wiki/List_of_`))},
+			Rule{Action: Include, Matcher: MatchPrefix("/wiki/")},
+		)
+		cases := map[string]bool{
+			"https://en.wikipedia.org/wiki/File:Sharing_(novel)": true,
+			"https://en.wikipedia.org/wiki/File:Fife.jpg":        false,
+			"https://en.wikipedia.org/wiki/Image:Fife.jpg":       false,
+			"https://en.wikipedia.org/wiki/category:Fife":        false,
+			"https://en.wikipedia.org/wiki/X-File:_The_Movie":    true,
+			"https://en.wikipedia.org/wiki/Map.SVG":              false,
+			"https://en.wikipedia.org/wiki/List_of_towns":        false,
+			"https://en.wikipedia.org/wiki/Kirkcaldy":            true,
+			"https://example.com/Kirkcaldy":                      false,
+		}
+
+		for link, expected := range cases {
+			if allowed(filter, link) != expected {
+				t.Errorf("Expected '%s' to be allowed: %v", link, expected)
+			}
+		}
+	})
+
+	t.Run("Localized namespaces", func(t *testing.T) {
+		namespaces := DefaultNamespaces()
+		namespaces.Add("Datei", 6)
+		filter := NewRuleFilter(Include, Rule{Action: Exclude, Matcher: MatchNamespace(namespaces, 6)})
+
+		if allowed(filter, "https://de.wikipedia.org/wiki/Datei:Fife.png") {
+			t.Error("Expected the localized file namespace to be excluded")
+		}
+
+		if namespaces.Of("Film:_The_Movie") != 0 || namespaces.Of("User_talk:Someone") != 3 {
+			t.Error("Expected only known namespace names to be namespaces")
+		}
+	})
+}
+
+func TestParseLinkFilter(t *testing.T) {
+	t.Run("Read rules in order", func(t *testing.T) {
+		filter, err := ParseLinkFilter([]byte(`{
+	"default": "exclude",
+	"namespaces": {"Datei": 6},
+	"rules": [
+		{"action": "exclude", "namespace": ["Special", "Datei", 4]},
+		{"action": "exclude", "extension": [".jpg"]},
+		{"action": "include", "prefix": ["/wiki/"]}
+	]
+}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		p := NewParser("https://de.wikipedia.org", nil, nil, nil, WithLinkFilter(filter))
+		result, err := p.GetLinks(`<html><body><a href="/wiki/Fife">Fife</a><a href="/wiki/Datei:Fife.png">map</a>
+<a href="/wiki/Wikipedia:Hauptseite">main page</a><a href="/w/index.php?title=Fife&action=edit">edit</a></body></html>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{"https://de.wikipedia.org/wiki/Fife"}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%q' but got '%q'", expected, result)
+		}
+	})
+
+	invalid := map[string]string{
+		"Not JSON":          `{`,
+		"Unknown action":    `{"rules": [{"action": "skip", "prefix": ["/wiki/"]}]}`,
+		"Missing action":    `{"rules": [{"prefix": ["/wiki/"]}]}`,
+		"No matcher":        `{"rules": [{"action": "include"}]}`,
+		"Two matchers":      `{"rules": [{"action": "include", "prefix": ["/wiki/"], "glob": "/wiki/*"}]}`,
+		"Bad regex":         `{"rules": [{"action": "include", "regex": "("}]}`,
+		"Bad glob":          `{"rules": [{"action": "include", "glob": "["}]}`,
+		"Unknown namespace": `{"rules": [{"action": "exclude", "namespace": ["Datei"]}]}`,
+		"Unknown default":   `{"default": "maybe"}`,
+	}
+
+	for name, config := range invalid {
+		config := config
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseLinkFilter([]byte(config)); err == nil {
+				t.Error("Expected the filter to be rejected")
+			}
+		})
+	}
+}
+
+func TestContentScope(t *testing.T) {
+	article := `<html><head><title>Fife</title></head><body>
+<div class="hatnote">Not to be confused with <a href="/wiki/Fife_whistle">the instrument</a></div>
+<a href="/wiki/Main_Page">Main page</a>
+<div id="mw-content-text"><div class="mw-parser-output">
+<table class="infobox"><tr><td><a href="/wiki/Scotland">Scotland</a></td></tr></table>
+<p>Fife is a council area of <a href="/wiki/Scotland">Scotland</a>, between the
+<div><div>firths of <a href="/wiki/Firth_of_Tay">Tay</a></div></div> and <a href="/wiki/Firth_of_Forth">Forth</a>.</p>
+<div class="reflist"><ol><li><a href="/wiki/Reference">ref</a></li></ol></div>
+<div role="navigation" class="navbox hlist"><a href="/wiki/Angus">Angus</a></div>
+<h2>See also</h2><ul><li><a href="/wiki/Kingdom_of_Fife">Kingdom of Fife</a></li></ul>
+</div></div>
+<div id="catlinks"><a href="/wiki/Category:Fife">Fife</a></div>
+</body></html>`
+
+	scopedLinks := func(t *testing.T, scope *ContentScope, htm string) []string {
+		p := NewParser("", nil, nil, nil, WithContentScope(scope))
+		result, err := p.GetLinks(htm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return result
+	}
+
+	t.Run("Only find links in the region, outside excluded elements", func(t *testing.T) {
+		scope := MustNewContentScope("#mw-content-text .mw-parser-output", ".navbox", ".reflist", ".infobox", "#catlinks", ".hatnote")
+
+		expected := []string{"/wiki/Scotland", "/wiki/Firth_of_Tay", "/wiki/Firth_of_Forth", "/wiki/Kingdom_of_Fife"}
+		assertSameSlice(t, scopedLinks(t, scope, article), expected)
+	})
+
+	t.Run("Exclude without a region", func(t *testing.T) {
+		scope := MustNewContentScope("", "[role=navigation]", "div > ol")
+
+		expected := []string{"/wiki/Fife_whistle", "/wiki/Main_Page", "/wiki/Scotland", "/wiki/Firth_of_Tay",
+			"/wiki/Firth_of_Forth", "/wiki/Kingdom_of_Fife", "/wiki/Category:Fife"}
+		assertSameSlice(t, scopedLinks(t, scope, article), expected)
+	})
+
+	t.Run("Whole document without the region", func(t *testing.T) {
+		scope := MustNewContentScope("#bodyContent", "#catlinks")
+
+		expected := []string{"/wiki/Fife_whistle", "/wiki/Main_Page", "/wiki/Scotland", "/wiki/Firth_of_Tay",
+			"/wiki/Firth_of_Forth", "/wiki/Reference", "/wiki/Angus", "/wiki/Kingdom_of_Fife"}
+		assertSameSlice(t, scopedLinks(t, scope, article), expected)
+	})
+
+	t.Run("Keep the text of the first anchor in the region", func(t *testing.T) {
+		p := NewParser("", nil, nil, nil, WithContentScope(MustNewContentScope("main")))
+		result, err := p.ExtractLinks(`<a href="/wiki/Fife">menu</a><main><a href="/wiki/Fife">Fife</a></main>`)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []Link{{URL: "/wiki/Fife", Text: "Fife", Position: 1, InLead: true}}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%v' but got '%v'", expected, result)
+		}
+	})
+}
+
+func TestParseSelector(t *testing.T) {
+	open := []element{
+		{tag: "div", attrs: []html.Attribute{{Key: "id", Val: "mw-content-text"}}},
+		{tag: "div", attrs: []html.Attribute{{Key: "class", Val: "mw-parser-output  navbox"}}},
+		{tag: "table", attrs: []html.Attribute{{Key: "role", Val: "presentation"}}},
+	}
+
+	matching := []string{"table", "*", "div table", "#mw-content-text > .navbox > table", "[role]",
+		`table[role="presentation"]`, ".mw-parser-output.navbox table", "p, div.navbox table", "DIV TABLE"}
+	for _, text := range matching {
+		if !MustParseSelector(text).matches(open) {
+			t.Errorf("Expected %q to match", text)
+		}
+	}
+
+	notMatching := []string{"div", "#mw-content-text > table", ".infobox table", "[role=navigation]", "p table"}
+	for _, text := range notMatching {
+		if MustParseSelector(text).matches(open) {
+			t.Errorf("Expected %q not to match", text)
+		}
+	}
+
+	for _, text := range []string{"", "div,", "> div", "div >", "#", ".a..b", "[role", `[role="x]`, "div ~ p"} {
+		if _, err := ParseSelector(text); err == nil {
+			t.Errorf("Expected %q to be rejected", text)
+		}
+	}
+}
+
+func TestLinkContext(t *testing.T) {
+	article := `<html><body><div id="mw-content-text"><div class="mw-parser-output">
+<table class="infobox"><tr><td><a href="/wiki/Scotland">Scotland</a></td></tr></table>
+<p><b>Fife</b> is a council area of <a href="/wiki/Scotland">Scotland</a>.</p>
+<p>Its towns include <a href="/wiki/Kirkcaldy">Kirkcaldy</a>.</p>
+<h2><span class="mw-headline">History</span><span class="mw-editsection">[<a href="/w/index.php?action=edit">edit</a>]</span></h2>
+<p>It was a <a href="/wiki/Pictland">Pictish</a> kingdom.</p>
+<h3>Mining</h3>
+<ul><li><a href="/wiki/Kirkcaldy">Kirkcaldy</a> pits</li></ul>
+</div></div></body></html>`
+	scope := MustNewContentScope("#mw-content-text .mw-parser-output", ".mw-editsection")
+
+	t.Run("Find where each link is", func(t *testing.T) {
+		p := NewParser("", []string{"/wiki/"}, nil, nil, WithContentScope(scope))
+		result, err := p.ExtractLinks(article)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []Link{
+			{URL: "/wiki/Scotland", Text: "Scotland", Position: 1, InLead: true, InInfobox: true, InTable: true},
+			{URL: "/wiki/Kirkcaldy", Text: "Kirkcaldy", Paragraph: 2, Position: 3, InLead: true},
+			{URL: "/wiki/Pictland", Text: "Pictish", Section: "History", Paragraph: 3, Position: 4},
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%+v' but got '%+v'", expected, result)
+		}
+	})
+
+	t.Run("Keep duplicates", func(t *testing.T) {
+		p := NewParser("", []string{"/wiki/"}, nil, nil, WithContentScope(scope), WithKeepDuplicates(true))
+		result, err := p.ExtractLinks(article)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []Link{
+			{URL: "/wiki/Scotland", Text: "Scotland", Position: 1, InLead: true, InInfobox: true, InTable: true},
+			{URL: "/wiki/Scotland", Text: "Scotland", Paragraph: 1, Position: 2, InLead: true},
+			{URL: "/wiki/Kirkcaldy", Text: "Kirkcaldy", Paragraph: 2, Position: 3, InLead: true},
+			{URL: "/wiki/Pictland", Text: "Pictish", Section: "History", Paragraph: 3, Position: 4},
+			{URL: "/wiki/Kirkcaldy", Text: "Kirkcaldy", Section: "Mining", Position: 5, InList: true},
+		}
+		if !reflect.DeepEqual(result, expected) {
+			t.Errorf("Expected '%+v' but got '%+v'", expected, result)
+		}
+	})
+}
+
+func TestLinkModes(t *testing.T) {
+	article := `<html><head><title>Fife</title><link rel="canonical" href="/wiki/Fife"></head><body>
+<table class="infobox"><tr><td><a href="/wiki/Scotland">Scotland</a></td></tr></table>
+<p><b>Fife</b> (<a href="/wiki/Help:IPA">/faɪf/</a>; <a href="/wiki/Scots_language">Scots</a>: Fife) is an area
+of <i><a href="/wiki/Alba">Alba</a></i>, between the <a href="/wiki/Firth_of_Tay">Tay</a> and the
+<a href="/wiki/Firth_of_Forth">Forth</a>.</p>
+<h2>History</h2>
+<p>It was a <a href="/wiki/Pictland">Pictish</a> kingdom.</p>
+</body></html>`
+
+	t.Run("Lead section only", func(t *testing.T) {
+		p := NewParser("", []string{"/wiki/"}, nil, nil, WithLinkMode(LeadLinks))
+		page, err := p.Parse(article)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		result := make([]string, 0)
+		for _, link := range page.Links {
+			result = append(result, link.URL)
+		}
+
+		expected := []string{"/wiki/Scotland", "/wiki/Help:IPA", "/wiki/Scots_language", "/wiki/Alba",
+			"/wiki/Firth_of_Tay", "/wiki/Firth_of_Forth"}
+		assertSameSlice(t, result, expected)
+
+		if page.CanonicalURL != "/wiki/Fife" {
+			t.Errorf("Expected the canonical URL to be read but got '%s'", page.CanonicalURL)
+		}
+	})
+
+	t.Run("First link outside parentheses, italics and infoboxes", func(t *testing.T) {
+		p := NewParser("", []string{"/wiki/"}, nil, nil, WithLinkMode(FirstLink))
+		result, err := p.GetLinks(article)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertSameSlice(t, result, []string{"/wiki/Firth_of_Tay"})
+	})
+
+	t.Run("First link of a document without the region", func(t *testing.T) {
+		p := NewParser("", []string{"/wiki/"}, nil, nil, WithLinkMode(FirstLink),
+			WithContentScope(MustNewContentScope("#mw-content-text", ".infobox")))
+		result, err := p.GetLinks(article)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertSameSlice(t, result, []string{"/wiki/Firth_of_Tay"})
+	})
+
+	t.Run("Copy with options", func(t *testing.T) {
+		p := NewParser("", nil, nil, nil)
+		if p.With(WithLinkMode(FirstLink)).LinkMode() != FirstLink || p.LinkMode() != AllLinks {
+			t.Error("Expected only the copy to have the new link mode")
+		}
+	})
+}
@@ -0,0 +1,343 @@
+package parser
+
+import (
+	"fmt"
+	"golang.org/x/net/html"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Selector : a list of CSS selectors, matched against the elements open while a document is
+// tokenized. Type, universal, id, class and attribute selectors, such as "div", "*", "#catlinks",
+// ".navbox" and "[role=navigation]", may be combined with the descendant and child combinators,
+// and several selectors may be separated by commas
+type Selector struct {
+	text      string
+	complexes []complexSelector
+}
+
+// complexSelector : compound selectors joined by combinators, so combinators[i] is ' ' or '>'
+// and joins compounds[i] to compounds[i+1]
+type complexSelector struct {
+	compounds   []compoundSelector
+	combinators []byte
+}
+
+// compoundSelector : the conditions a single element must meet. An empty tag matches any element
+type compoundSelector struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []attrSelector
+}
+
+type attrSelector struct {
+	key      string
+	value    string
+	hasValue bool
+}
+
+// element : an open element of a document, as selectors see it
+type element struct {
+	tag   string
+	attrs []html.Attribute
+}
+
+// ContentScope : the part of a document links are taken from: the elements matching the include
+// selector and everything inside them, leaving out the elements matching any of the exclude
+// selectors and everything inside those. Without an include selector the whole document is in scope
+type ContentScope struct {
+	include  *Selector
+	excludes []*Selector
+}
+
+// NewContentScope : Creates a content scope from the given include selector, which may be empty,
+// and exclude selectors
+func NewContentScope(include string, excludes ...string) (*ContentScope, error) {
+	scope := ContentScope{}
+	if strings.TrimSpace(include) != "" {
+		selector, err := ParseSelector(include)
+		if err != nil {
+			return nil, err
+		}
+		scope.include = selector
+	}
+
+	for _, exclude := range excludes {
+		selector, err := ParseSelector(exclude)
+		if err != nil {
+			return nil, err
+		}
+		scope.excludes = append(scope.excludes, selector)
+	}
+
+	return &scope, nil
+}
+
+// MustNewContentScope : Creates a content scope like NewContentScope, panicking if a selector is
+// invalid, for selectors known when the program is written
+func MustNewContentScope(include string, excludes ...string) *ContentScope {
+	scope, err := NewContentScope(include, excludes...)
+	if err != nil {
+		panic(err)
+	}
+
+	return scope
+}
+
+// idScope : Gets the scope of the element with the given id
+func idScope(id string) *ContentScope {
+	return &ContentScope{include: &Selector{
+		text:      "#" + id,
+		complexes: []complexSelector{{compounds: []compoundSelector{{id: id}}}},
+	}}
+}
+
+// ParseSelector : Parses a comma separated list of selectors
+func ParseSelector(text string) (*Selector, error) {
+	selector := Selector{text: text}
+	for _, part := range strings.Split(text, ",") {
+		complex, err := parseComplexSelector(part)
+		if err != nil {
+			return nil, fmt.Errorf("selector %q: %w", text, err)
+		}
+
+		selector.complexes = append(selector.complexes, complex)
+	}
+
+	return &selector, nil
+}
+
+// MustParseSelector : Parses a selector like ParseSelector, panicking if it is invalid, for
+// selectors known when the program is written
+func MustParseSelector(text string) *Selector {
+	selector, err := ParseSelector(text)
+	if err != nil {
+		panic(err)
+	}
+
+	return selector
+}
+
+// String : Gets the text the selector was parsed from
+func (s *Selector) String() string {
+	return s.text
+}
+
+// matches : Reports whether the last of the open elements, the innermost, matches the selector
+// given the elements it is inside of
+func (s *Selector) matches(open []element) bool {
+	for _, complex := range s.complexes {
+		if complex.matches(open, len(open)-1, len(complex.compounds)-1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matches : Reports whether the open element at the given index matches the compound selector at
+// the given index, and the elements it is inside of match the compound selectors before it
+func (c complexSelector) matches(open []element, index int, compound int) bool {
+	if index < 0 || !c.compounds[compound].matches(open[index]) {
+		return false
+	}
+
+	if compound == 0 {
+		return true
+	}
+
+	if c.combinators[compound-1] == '>' {
+		return c.matches(open, index-1, compound-1)
+	}
+
+	for ancestor := index - 1; ancestor >= 0; ancestor-- {
+		if c.matches(open, ancestor, compound-1) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c compoundSelector) matches(e element) bool {
+	if c.tag != "" && c.tag != e.tag {
+		return false
+	}
+
+	if c.id != "" && e.attribute("id") != c.id {
+		return false
+	}
+
+	if len(c.classes) != 0 {
+		classes := strings.Fields(e.attribute("class"))
+		for _, class := range c.classes {
+			if !containsString(classes, class) {
+				return false
+			}
+		}
+	}
+
+	for _, attr := range c.attrs {
+		value, exists := e.findAttribute(attr.key)
+		if !exists || (attr.hasValue && value != attr.value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (e element) findAttribute(key string) (string, bool) {
+	for _, attr := range e.attrs {
+		if attr.Key == key {
+			return attr.Val, true
+		}
+	}
+
+	return "", false
+}
+
+func (e element) attribute(key string) string {
+	value, _ := e.findAttribute(key)
+	return value
+}
+
+// parseComplexSelector : Parses a selector without commas
+func parseComplexSelector(text string) (complexSelector, error) {
+	var complex complexSelector
+	rest := strings.TrimSpace(text)
+	if rest == "" {
+		return complex, fmt.Errorf("empty selector")
+	}
+
+	for {
+		compound, remaining, err := parseCompoundSelector(rest)
+		if err != nil {
+			return complex, err
+		}
+		complex.compounds = append(complex.compounds, compound)
+
+		trimmed := strings.TrimLeftFunc(remaining, unicode.IsSpace)
+		if trimmed == "" {
+			return complex, nil
+		}
+
+		combinator := byte(' ')
+		if trimmed[0] == '>' {
+			combinator = '>'
+			trimmed = strings.TrimLeftFunc(trimmed[1:], unicode.IsSpace)
+		} else if len(trimmed) == len(remaining) {
+			return complex, fmt.Errorf("unexpected %q", trimmed[:1])
+		}
+
+		if trimmed == "" {
+			return complex, fmt.Errorf("missing selector after combinator")
+		}
+
+		complex.combinators = append(complex.combinators, combinator)
+		rest = trimmed
+	}
+}
+
+// parseCompoundSelector : Parses the compound selector at the start of the text, returning the
+// text after it
+func parseCompoundSelector(text string) (compoundSelector, string, error) {
+	var compound compoundSelector
+	rest := text
+	if strings.HasPrefix(rest, "*") {
+		rest = rest[1:]
+	} else if name, remaining := parseIdentifier(rest); name != "" {
+		compound.tag, rest = strings.ToLower(name), remaining
+	}
+
+	for rest != "" {
+		switch rest[0] {
+		case '#', '.':
+			name, remaining := parseIdentifier(rest[1:])
+			if name == "" {
+				return compound, "", fmt.Errorf("missing name after %q", rest[:1])
+			}
+
+			if rest[0] == '#' {
+				compound.id = name
+			} else {
+				compound.classes = append(compound.classes, name)
+			}
+			rest = remaining
+		case '[':
+			attr, remaining, err := parseAttrSelector(rest[1:])
+			if err != nil {
+				return compound, "", err
+			}
+			compound.attrs = append(compound.attrs, attr)
+			rest = remaining
+		default:
+			if rest == text {
+				return compound, "", fmt.Errorf("unexpected %q", rest[:1])
+			}
+			return compound, rest, nil
+		}
+	}
+
+	return compound, rest, nil
+}
+
+// parseAttrSelector : Parses an attribute selector after its opening bracket, such as "role]" or
+// `role="navigation"]`, returning the text after the closing bracket
+func parseAttrSelector(text string) (attrSelector, string, error) {
+	var attr attrSelector
+	rest := strings.TrimLeftFunc(text, unicode.IsSpace)
+	name, rest := parseIdentifier(rest)
+	if name == "" {
+		return attr, "", fmt.Errorf("missing attribute name")
+	}
+	attr.key = strings.ToLower(name)
+
+	rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+	if strings.HasPrefix(rest, "=") {
+		rest = strings.TrimLeftFunc(rest[1:], unicode.IsSpace)
+		attr.hasValue = true
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			end := strings.IndexByte(rest[1:], rest[0])
+			if end < 0 {
+				return attr, "", fmt.Errorf("unterminated attribute value")
+			}
+			attr.value, rest = rest[1:end+1], rest[end+2:]
+		} else {
+			attr.value, rest = parseIdentifier(rest)
+		}
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+	}
+
+	if !strings.HasPrefix(rest, "]") {
+		return attr, "", fmt.Errorf("missing ] after attribute %q", attr.key)
+	}
+
+	return attr, rest[1:], nil
+}
+
+// parseIdentifier : Splits the name of an element, id, class or attribute off the start of the text
+func parseIdentifier(text string) (string, string) {
+	end := 0
+	for end < len(text) {
+		r, size := utf8.DecodeRuneInString(text[end:])
+		if r != '-' && r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) && r < utf8.RuneSelf {
+			break
+		}
+		end += size
+	}
+
+	return text[:end], text[end:]
+}
+
+func containsString(values []string, value string) bool {
+	for _, candidate := range values {
+		if candidate == value {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,506 @@
+package parser
+
+import (
+	"WikiGo/normalize"
+	"WikiGo/wikipage"
+	"bytes"
+	"encoding/json"
+	"golang.org/x/net/html"
+	"io"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// trimReadSize : number of bytes a trimReader reads from the underlying reader at a time
+const trimReadSize = 32 << 10
+
+// trimReader : io.Reader that stops with io.EOF at the first of its markers in the underlying reader
+type trimReader struct {
+	r        io.Reader
+	markers  [][]byte
+	holdBack int
+	buf      []byte
+	pending  []byte
+	done     bool
+	err      error
+}
+
+// newTrimReader : Creates a reader that stops at the earliest of the given markers. Empty
+// markers are ignored, and without markers the reader is returned as is
+func newTrimReader(r io.Reader, markers []string) io.Reader {
+	t := trimReader{r: r}
+	for _, marker := range markers {
+		if marker == "" {
+			continue
+		}
+
+		t.markers = append(t.markers, []byte(marker))
+		if len(marker)-1 > t.holdBack {
+			t.holdBack = len(marker) - 1
+		}
+	}
+
+	if len(t.markers) == 0 {
+		return r
+	}
+
+	t.buf = make([]byte, trimReadSize)
+	return &t
+}
+
+// Read : Reads the document up to the first marker
+func (t *trimReader) Read(b []byte) (int, error) {
+	for !t.done {
+		if index := t.markerIndex(); index >= 0 {
+			t.pending, t.done, t.err = t.pending[:index], true, io.EOF
+			break
+		}
+
+		if safe := len(t.pending) - t.holdBack; safe > 0 {
+			n := copy(b, t.pending[:safe])
+			t.pending = t.pending[n:]
+			return n, nil
+		}
+
+		n, err := t.r.Read(t.buf)
+		t.pending = append(t.pending, t.buf[:n]...)
+		if err != nil {
+			t.done, t.err = true, err
+			if index := t.markerIndex(); index >= 0 {
+				t.pending, t.err = t.pending[:index], io.EOF
+			}
+		}
+	}
+
+	if len(t.pending) == 0 {
+		return 0, t.err
+	}
+
+	n := copy(b, t.pending)
+	t.pending = t.pending[n:]
+	return n, nil
+}
+
+// markerIndex : Gets the index of the earliest marker in the pending bytes, or -1 if there is none
+func (t *trimReader) markerIndex() int {
+	earliest := -1
+	for _, marker := range t.markers {
+		if index := bytes.Index(t.pending, marker); index >= 0 && (earliest < 0 || index < earliest) {
+			earliest = index
+		}
+	}
+
+	return earliest
+}
+
+// voidElements : elements that never have content or an end tag, so are never open
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// headingElements : the elements that start a section of an article. The <h1> is the title of
+// the page, not a section
+var headingElements = map[string]bool{"h2": true, "h3": true, "h4": true, "h5": true, "h6": true}
+
+// openElement : an element the tokenizer is inside of, whether it is in the content scope, and
+// what the links inside of it are in
+type openElement struct {
+	element
+	included  bool
+	excluded  bool
+	paragraph int
+	infobox   bool
+	table     bool
+	list      bool
+	italics   bool
+}
+
+// stream : Tokenizes the document read from r into page, calling visit with each link in scope
+func (p *Parser) stream(r io.Reader, documentURL string, scope *ContentScope, fallback bool, page *ParsedPage, visit func(Link) error) error {
+	tokenizer := html.NewTokenizer(newTrimReader(r, p.trimMarkers))
+	base := p.documentBase(documentURL)
+	hasBase := false
+	seen := make(map[string]bool)
+	pageName := ""
+	displayTitle := ""
+	documentTitle := ""
+	rawTag := ""
+	firstHeading := -1
+	var firstHeadingText strings.Builder
+
+	// The open elements are tracked as an HTML parser would, roughly: an end tag closes the
+	// innermost open element with its name and everything inside it, and stray end tags are ignored
+	var open []openElement
+	opened := func(e element) openElement {
+		entry := openElement{element: e}
+		if len(open) > 0 {
+			entry = open[len(open)-1]
+			entry.element = e
+		}
+
+		switch e.tag {
+		case "table":
+			entry.table = true
+		case "ul", "ol", "dl":
+			entry.list = true
+		case "i", "em":
+			entry.italics = true
+		}
+
+		if containsString(strings.Fields(e.attribute("class")), "infobox") {
+			entry.infobox = true
+		}
+
+		if scope == nil {
+			entry.included = true
+			return entry
+		}
+
+		elements := make([]element, 0, len(open)+1)
+		for _, ancestor := range open {
+			elements = append(elements, ancestor.element)
+		}
+		elements = append(elements, e)
+
+		if !entry.included && (scope.include == nil || scope.include.matches(elements)) {
+			entry.included = true
+		}
+
+		for _, exclude := range scope.excludes {
+			if !entry.excluded && exclude.matches(elements) {
+				entry.excluded = true
+			}
+		}
+
+		return entry
+	}
+
+	regionFound := false
+	var outside []Link
+	outsideSeen := make(map[string]bool)
+
+	// Sections, paragraphs, parentheses and positions are counted in the content, starting over
+	// when the region of the scope is found so that nothing before it counts
+	section := ""
+	inLead := true
+	paragraphs := 0
+	parentheses := 0
+	position := 0
+	found := 0
+	stopped := false
+	heading := -1
+	var headingText strings.Builder
+	inContent := func(entry openElement) bool {
+		return !entry.excluded && (entry.included || !regionFound)
+	}
+	closeHeading := func() {
+		if heading >= 0 {
+			section, inLead, heading = strings.Join(strings.Fields(headingText.String()), " "), false, -1
+
+			// No later link is in the lead, unless the region is yet to be found
+			if p.mode == LeadLinks && (regionFound || scope == nil || scope.include == nil) {
+				stopped = true
+			}
+		}
+	}
+
+	href := ""
+	inAnchor := false
+	anchor := openElement{}
+	anchorInParentheses := false
+	var anchorText strings.Builder
+	closeAnchor := func() error {
+		if !inAnchor {
+			return nil
+		}
+
+		inAnchor = false
+		url, keep := p.linkURL(base, href)
+		if !keep || anchor.excluded || (!anchor.included && (!fallback || regionFound)) {
+			return nil
+		}
+
+		position++
+		link := Link{
+			URL:           url,
+			Text:          strings.Join(strings.Fields(anchorText.String()), " "),
+			Section:       section,
+			Paragraph:     anchor.paragraph,
+			Position:      position,
+			InLead:        inLead,
+			InInfobox:     anchor.infobox,
+			InTable:       anchor.table,
+			InList:        anchor.list,
+			InItalics:     anchor.italics,
+			InParentheses: anchorInParentheses,
+		}
+
+		if !anchor.included {
+			if p.allows(link, len(outside)) && (p.keepDuplicates || !outsideSeen[url]) {
+				outsideSeen[url] = true
+				outside = append(outside, link)
+			}
+			return nil
+		}
+
+		if !p.allows(link, found) || (seen[url] && !p.keepDuplicates) {
+			return nil
+		}
+
+		seen[url] = true
+		found++
+		stopped = p.mode == FirstLink
+		return visit(link)
+	}
+
+	for !stopped {
+		tokenType := tokenizer.Next()
+		if tokenType == html.ErrorToken {
+			break
+		}
+
+		token := tokenizer.Token()
+		switch tokenType {
+		case html.TextToken:
+			switch {
+			case rawTag == "title" && documentTitle == "":
+				documentTitle = token.Data
+			case rawTag == "script":
+				if match := pageNamePattern.FindStringSubmatch(token.Data); match != nil && pageName == "" {
+					json.Unmarshal([]byte(match[1]), &pageName)
+				}
+				if match := displayTitlePattern.FindStringSubmatch(token.Data); match != nil && displayTitle == "" {
+					json.Unmarshal([]byte(match[1]), &displayTitle)
+				}
+			}
+
+			if firstHeading >= 0 {
+				firstHeadingText.WriteString(token.Data)
+			}
+
+			if inAnchor {
+				anchorText.WriteString(token.Data)
+			}
+
+			if heading >= 0 && !open[len(open)-1].excluded {
+				headingText.WriteString(token.Data)
+			}
+
+			if !inAnchor && len(open) > 0 && inContent(open[len(open)-1]) {
+				for _, char := range token.Data {
+					if char == '(' {
+						parentheses++
+					} else if char == ')' && parentheses > 0 {
+						parentheses--
+					}
+				}
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if token.Data == "link" && page.CanonicalURL == "" && tokenAttribute(token, "rel") == "canonical" {
+				page.CanonicalURL = tokenAttribute(token, "href")
+			}
+
+			if value, exists := findAttribute(token, "href"); exists && token.Data == "base" && !hasBase {
+				if ref, err := url.Parse(strings.TrimSpace(value)); err == nil {
+					base, hasBase = resolveURL(base, ref), true
+				}
+			}
+
+			if token.Data == "a" {
+				if err := closeAnchor(); err != nil {
+					return err
+				}
+			}
+
+			// As in a parsed tree, an element is open until it is closed even if its tag ends
+			// with "/>", which an unquoted href ending in a slash does
+			entry := opened(element{tag: token.Data, attrs: token.Attr})
+			if scope != nil && scope.include != nil && entry.included && !regionFound {
+				regionFound, outside = true, nil
+				section, inLead, paragraphs, parentheses, position, heading = "", true, 0, 0, 0, -1
+			}
+
+			if token.Data == "p" && inContent(entry) {
+				paragraphs++
+				entry.paragraph = paragraphs
+			}
+
+			if (token.Data == "p" || token.Data == "li") && inContent(entry) {
+				parentheses = 0
+			}
+
+			if headingElements[token.Data] && inContent(entry) {
+				closeHeading()
+				heading = len(open)
+				headingText.Reset()
+			}
+
+			if token.Data == "h1" && tokenAttribute(token, "id") == firstHeadingID && firstHeading < 0 &&
+				firstHeadingText.Len() == 0 {
+				firstHeading = len(open)
+			}
+
+			if !voidElements[token.Data] {
+				open = append(open, entry)
+			}
+
+			if value, exists := findAttribute(token, "href"); exists && token.Data == "a" {
+				href, inAnchor, anchor, anchorInParentheses = value, true, entry, parentheses > 0
+				anchorText.Reset()
+			}
+		case html.EndTagToken:
+			if token.Data == "a" {
+				if err := closeAnchor(); err != nil {
+					return err
+				}
+			}
+
+			for index := len(open) - 1; index >= 0; index-- {
+				if open[index].tag == token.Data {
+					if heading >= index {
+						closeHeading()
+					}
+					if firstHeading >= index {
+						firstHeading = -1
+					}
+					open = open[:index]
+					break
+				}
+			}
+		}
+
+		rawTag = ""
+		if tokenType == html.StartTagToken {
+			rawTag = token.Data
+		}
+	}
+
+	if err := tokenizer.Err(); err != nil && err != io.EOF {
+		return err
+	}
+
+	if err := closeAnchor(); err != nil {
+		return err
+	}
+
+	if !regionFound {
+		for _, link := range outside {
+			if err := visit(link); err != nil {
+				return err
+			}
+		}
+	}
+
+	page.Title = documentTitle
+	if displayTitle != "" {
+		page.Title = displayTitle
+	} else if heading := strings.Join(strings.Fields(firstHeadingText.String()), " "); heading != "" {
+		page.Title = heading
+	}
+
+	if page.CanonicalURL != "" {
+		if ref, err := url.Parse(strings.TrimSpace(page.CanonicalURL)); err == nil {
+			page.CanonicalURL = resolveURL(base, ref).String()
+		}
+		page.CanonicalURL = normalize.URL(page.CanonicalURL)
+	}
+
+	if pageName != "" {
+		host := base.Host
+		if page.CanonicalURL != "" {
+			host = normalize.Host(page.CanonicalURL)
+		}
+		page.Key = wikipage.KeyFromPageName(host, pageName)
+	} else if page.CanonicalURL != "" {
+		page.Key = wikipage.KeyFromURL(page.CanonicalURL)
+	}
+
+	return nil
+}
+
+// documentBase : Gets the URL links are resolved against without a <base href>, from the domain
+func (p *Parser) documentBase(documentURL string) *url.URL {
+	base, err := url.Parse(p.domain)
+	if err != nil {
+		base = &url.URL{}
+	}
+
+	if documentURL == "" {
+		return base
+	}
+
+	document, err := url.Parse(documentURL)
+	if err != nil {
+		return base
+	}
+
+	return resolveURL(base, document)
+}
+
+// resolveURL : Resolves ref against base, keeping relative bases such as local file paths relative
+func resolveURL(base *url.URL, ref *url.URL) *url.URL {
+	if *base == (url.URL{}) {
+		return ref
+	}
+
+	if ref.IsAbs() || ref.Host != "" || base.IsAbs() || base.Host != "" ||
+		strings.HasPrefix(base.Path, "/") || strings.HasPrefix(ref.Path, "/") {
+		return base.ResolveReference(ref)
+	}
+
+	resolved := *ref
+	if ref.Path == "" {
+		resolved.Path = base.Path
+		return &resolved
+	}
+
+	resolved.Path = path.Join(path.Dir(base.Path), ref.Path)
+	if strings.HasPrefix(base.Path, "./") && !strings.HasPrefix(resolved.Path, "../") {
+		resolved.Path = "./" + resolved.Path
+	}
+
+	return &resolved
+}
+
+// linkURL : Gets the normalized URL of the link with the given href, or false if it isn't followed
+func (p *Parser) linkURL(base *url.URL, href string) (string, bool) {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") {
+		return "", false
+	}
+
+	ref, err := url.Parse(href)
+	if err != nil {
+		return "", false
+	}
+
+	resolved := resolveURL(base, ref)
+	switch strings.ToLower(resolved.Scheme) {
+	case "", "http", "https", "file":
+	default:
+		return "", false
+	}
+
+	if !p.filter.Allow(resolved, base) {
+		return "", false
+	}
+
+	return normalize.URL(resolved.String()), true
+}
+
+func findAttribute(token html.Token, key string) (string, bool) {
+	for _, attr := range token.Attr {
+		if attr.Key == key {
+			return attr.Val, true
+		}
+	}
+
+	return "", false
+}
+
+func tokenAttribute(token html.Token, key string) string {
+	value, _ := findAttribute(token, key)
+	return value
+}
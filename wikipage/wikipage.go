@@ -1,26 +1,72 @@
 package wikipage
 
-// WikiPage : a struct representing a Wiki page and its links
+import (
+	"WikiGo/normalize"
+	"strings"
+)
+
+// PageKey : stable identifier of a page. Articles are keyed by the host of their wiki and their
+// MediaWiki page name, e.g. "en.wikipedia.org/Lawrence_Daly", which unlike the text of the <title>
+// element doesn't change with the skin or language of the wiki, or by the page name alone if the
+// host isn't known. Pages that aren't articles are keyed by their normalized URL
+type PageKey string
+
+// KeyFromURL : Gets the key of the page at the given URL
+func KeyFromURL(url string) PageKey {
+	if name := normalize.PageName(url); name != "" {
+		return keyOnHost(normalize.Host(url), name)
+	}
+
+	return PageKey(normalize.URL(url))
+}
+
+// KeyFromPageName : Gets the key of an article on the wiki at the given host, empty if it isn't
+// known, from its page name, as found in the wgPageName value embedded in MediaWiki pages
+func KeyFromPageName(host string, name string) PageKey {
+	return keyOnHost(strings.ToLower(host), strings.ReplaceAll(normalize.Title(name), " ", "_"))
+}
+
+func keyOnHost(host string, name string) PageKey {
+	if host == "" {
+		return PageKey(name)
+	}
+
+	return PageKey(host + "/" + name)
+}
+
+// WikiPage : a struct representing a Wiki page and its links. The title is the human readable
+// title of the page and the key identifies it
 type WikiPage struct {
+	key       PageKey
 	url       string
 	title     string
 	links     []string
 	isCrawled bool
 }
 
-// NewWikiPage : Creates a new wikipage object with the given url, title and links
+// NewWikiPage : Creates a new wikipage object with the given url, title and links, keyed by its title
 func NewWikiPage(url string, title string, links []string) *WikiPage {
-	return &WikiPage{url: url, title: title, links: links, isCrawled: false}
+	return &WikiPage{key: PageKey(title), url: url, title: title, links: links, isCrawled: false}
 }
 
 // NewWikiPageWithCrawlStatus : Creates a new wikipage object with the given url, title and links, and set crawled status
 func NewWikiPageWithCrawlStatus(url string, title string, links []string, isCrawled bool) *WikiPage {
-	return &WikiPage{url: url, title: title, links: links, isCrawled: isCrawled}
+	return &WikiPage{key: PageKey(title), url: url, title: title, links: links, isCrawled: isCrawled}
+}
+
+// NewWikiPageWithKey : Creates a new wikipage object with the given key, url, title, links and crawled status
+func NewWikiPageWithKey(key PageKey, url string, title string, links []string, isCrawled bool) *WikiPage {
+	return &WikiPage{key: key, url: url, title: title, links: links, isCrawled: isCrawled}
 }
 
 // NewWikiPageNoLinks : Creates a new wikipage object with no links
 func NewWikiPageNoLinks(url string, title string) *WikiPage {
-	return &WikiPage{url: url, title: title, links: make([]string, 0)}
+	return &WikiPage{key: PageKey(title), url: url, title: title, links: make([]string, 0)}
+}
+
+// GetKey : Gets the wikipage's key
+func (w *WikiPage) GetKey() PageKey {
+	return w.key
 }
 
 // GetURL : Gets the wikipage's URL